@@ -0,0 +1,73 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// atomicFile 先写到目标目录中的临时文件，commit 时再改名为目标文件。
+// 改名在同一个文件系统内是原子的，读取日志的程序只会看到旧的完整文件或新的完整文件，
+// 进程在写入途中被杀死也不会留下截断的日志
+type atomicFile struct {
+	file *os.File
+	name string
+	err  error // 第一次写入失败的错误，commit 时返回
+	done bool
+}
+
+// createAtomicFile 为 name 创建临时文件，临时文件以 "." 开头，与目标文件在同一目录
+func createAtomicFile(name string) (*atomicFile, error) {
+	file, err := os.CreateTemp(filepath.Dir(name), "."+filepath.Base(name)+".tmp-*")
+	if err != nil {
+		return nil, err
+	}
+	return &atomicFile{file: file, name: name}, nil
+}
+
+// createOutputFile 在输出目录中创建日志文件 filename
+func createOutputFile(filename string) (*atomicFile, error) {
+	return createAtomicFile(outputPath(filename))
+}
+
+// Write 写入临时文件，并记下第一次出现的错误，调用者可以不检查每次 fmt.Fprintf 的结果
+func (f *atomicFile) Write(p []byte) (int, error) {
+	n, err := f.file.Write(p)
+	if err != nil && f.err == nil {
+		f.err = err
+	}
+	return n, err
+}
+
+// commit 关闭临时文件并改名为目标文件；之前的写入出过错时放弃临时文件并返回该错误
+func (f *atomicFile) commit() error {
+	if f.done {
+		return nil
+	}
+	if f.err != nil {
+		f.Close()
+		return f.err
+	}
+	f.done = true
+	// CreateTemp 创建的文件权限是 0600，改成与 os.Create 相同的权限
+	err := f.file.Chmod(0644)
+	if closeErr := f.file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.file.Name(), f.name)
+	}
+	if err != nil {
+		os.Remove(f.file.Name())
+	}
+	return err
+}
+
+// Close 在没有 commit 时关闭并删除临时文件，目标文件保持不变；可以放在 defer 中
+func (f *atomicFile) Close() error {
+	if f.done {
+		return nil
+	}
+	f.done = true
+	f.file.Close()
+	return os.Remove(f.file.Name())
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/huangyingw/FileSorter/scanner"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// intList 是逗号分隔的正整数列表参数，例如 -benchmark-workers 1,4,16
+type intList []int
+
+func (l *intList) String() string {
+	parts := make([]string, len(*l))
+	for i, n := range *l {
+		parts[i] = strconv.Itoa(n)
+	}
+	return strings.Join(parts, ",")
+}
+
+func (l *intList) Set(value string) error {
+	var list []int
+	for _, part := range strings.Split(value, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || n <= 0 {
+			return fmt.Errorf("invalid worker count %q", part)
+		}
+		list = append(list, n)
+	}
+	*l = list
+	return nil
+}
+
+// benchResult 是用一个 worker 数遍历一遍的结果
+type benchResult struct {
+	Workers int
+	Entries int64 // 遍历到的非目录条目数
+	Files   int   // 达到大小阈值的文件数
+	Elapsed time.Duration
+}
+
+func (r benchResult) String() string {
+	seconds := r.Elapsed.Seconds()
+	if seconds <= 0 {
+		seconds = 1e-9
+	}
+	return fmt.Sprintf("workers %3d: %d entries, %d files in %s, %.1f entries/s",
+		r.Workers, r.Entries, r.Files, r.Elapsed.Round(time.Millisecond), float64(r.Entries)/seconds)
+}
+
+// measureThroughput 用 workers 个 worker 按 opts 遍历一遍，只读取结果不写入存储，返回耗时和数量
+func measureThroughput(ctx context.Context, opts scanner.Options, workers int) (benchResult, error) {
+	var entries int64
+	opts.Workers = workers
+	opts.Scanned = &entries
+	opts.Visit = nil
+	opts.HardlinksSkipped = nil
+
+	start := time.Now()
+	files, err := scanner.Scan(ctx, opts)
+	if err != nil {
+		return benchResult{}, err
+	}
+	count := 0
+	for range files {
+		count++
+	}
+	return benchResult{Workers: workers, Entries: entries, Files: count, Elapsed: time.Since(start)}, ctx.Err()
+}
+
+// benchmarkWorkers 先预热一遍让目录元数据进入缓存，再依次用每个 worker 数遍历，
+// 遍历中的错误只在预热时报告一次；ctx 被取消时返回已经完成的结果
+func benchmarkWorkers(ctx context.Context, opts scanner.Options, counts []int) ([]benchResult, error) {
+	if _, err := measureThroughput(ctx, opts, counts[len(counts)-1]); err != nil {
+		return nil, err
+	}
+	opts.OnError = nil
+
+	var results []benchResult
+	for _, workers := range counts {
+		r, err := measureThroughput(ctx, opts, workers)
+		if err != nil {
+			return results, err
+		}
+		results = append(results, r)
+	}
+	return results, nil
+}
+
+// fastest 返回耗时最短的结果，没有结果时返回 nil
+func fastest(results []benchResult) *benchResult {
+	var best *benchResult
+	for i := range results {
+		r := &results[i]
+		if best == nil || r.Elapsed < best.Elapsed {
+			best = r
+		}
+	}
+	return best
+}
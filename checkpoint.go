@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// checkpointHeader 是检查点文件的第一行，后面跟着命名空间，只有同一命名空间的扫描才会使用检查点
+const checkpointHeader = "# namespace "
+
+// checkpoint 记录一次被中断的扫描中已经完整遍历过的目录：这些目录中的文件都已写入存储，
+// -resume 时整个跳过。只在遍历的 goroutine 中使用，不需要加锁
+type checkpoint struct {
+	done map[string]bool // 目录的绝对路径
+}
+
+func newCheckpoint() *checkpoint {
+	return &checkpoint{done: make(map[string]bool)}
+}
+
+// loadCheckpoint 读取检查点文件，文件不存在时返回空的检查点；属于其他命名空间的检查点会被忽略
+func loadCheckpoint(filename string) (*checkpoint, error) {
+	c := newCheckpoint()
+	file, err := os.Open(outputPath(filename))
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	if !scanner.Scan() || scanner.Text() != checkpointHeader+namespace {
+		diagf("Warning: %s belongs to another scan, ignoring it\n", outputPath(filename))
+		return c, scanner.Err()
+	}
+	for scanner.Scan() {
+		if dir := scanner.Text(); dir != "" {
+			c.done[dir] = true
+		}
+	}
+	return c, scanner.Err()
+}
+
+// absDir 返回目录的绝对路径，无法解析时原样返回
+func absDir(dir string) string {
+	if abs, err := filepath.Abs(dir); err == nil {
+		return abs
+	}
+	return dir
+}
+
+// skip 判断目录是否已经在之前的扫描中完成
+func (c *checkpoint) skip(dir string) bool {
+	return c.done[absDir(dir)]
+}
+
+// markDone 记录一个已经完整遍历的目录
+func (c *checkpoint) markDone(dir string) {
+	c.done[absDir(dir)] = true
+}
+
+// ancestorDone 判断 dir 的某个上级目录是否已经完成
+func (c *checkpoint) ancestorDone(dir string) bool {
+	for parent := filepath.Dir(dir); parent != dir; dir, parent = parent, filepath.Dir(parent) {
+		if c.done[parent] {
+			return true
+		}
+	}
+	return false
+}
+
+// saveToFile 写出检查点，已完成目录之下的子目录不再重复列出
+func (c *checkpoint) saveToFile(filename string) error {
+	dirs := make([]string, 0, len(c.done))
+	for dir := range c.done {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+
+	file, err := createOutputFile(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	w := bufio.NewWriter(file)
+	fmt.Fprintln(w, checkpointHeader+namespace)
+	for _, dir := range dirs {
+		if !c.ancestorDone(dir) {
+			fmt.Fprintln(w, dir)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return file.commit()
+}
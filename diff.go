@@ -0,0 +1,180 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+)
+
+// sizeChange 是两次扫描之间一个文件的大小变化，新增的文件 Old 为 0，删除的文件 New 为 0
+type sizeChange struct {
+	Path string
+	Old  int64
+	New  int64
+}
+
+func (c sizeChange) delta() int64 {
+	return c.New - c.Old
+}
+
+// runDiff 实现 diff 子命令：比较两个按大小排序的日志（或存储中的两个命名空间），
+// 分三组输出新增、删除和大小变化的文件，每组按大小变化从大到小排序
+func runDiff(args []string) {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	useNamespaces := fs.Bool("namespaces", false, "compare two namespaces in the store instead of two log files")
+	addStoreFlags(fs)
+	addLogFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: ./find_large_files_with_cache diff [options] <old fav.log> <new fav.log>")
+		fmt.Fprintln(fs.Output(), "       ./find_large_files_with_cache diff -namespaces [options] <old namespace> <new namespace>")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 2 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	if err := applyLogFlags(); err != nil {
+		fmt.Fprintln(fs.Output(), err)
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var sizes [2]map[string]int64
+	for i, name := range fs.Args() {
+		var err error
+		if *useNamespaces {
+			sizes[i], err = readNamespaceSizes(ctx, name)
+		} else {
+			sizes[i], err = readLogSizes(name)
+		}
+		if err != nil {
+			errorf("Error reading %s: %s\n", name, err)
+			os.Exit(1)
+		}
+	}
+
+	added, removed, changed := diffSizes(sizes[0], sizes[1])
+	writeDiffSection(os.Stdout, "added", added)
+	writeDiffSection(os.Stdout, "removed", removed)
+	writeDiffSection(os.Stdout, "changed", changed)
+}
+
+// readLogSizes 读取一个按大小排序的日志，文件名以 .gz 结尾时先解压
+func readLogSizes(filename string) (map[string]int64, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var r io.Reader = file
+	if strings.HasSuffix(filename, ".gz") {
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		r = gz
+	}
+	entries, err := parseLog(r, false)
+	if err != nil {
+		return nil, err
+	}
+	sizes := make(map[string]int64, len(entries))
+	for _, e := range entries {
+		sizes[e.Path] = e.Size
+	}
+	return sizes, nil
+}
+
+// readNamespaceSizes 读取存储中命名空间 ns 下所有记录的大小
+func readNamespaceSizes(ctx context.Context, ns string) (map[string]int64, error) {
+	namespace = ns
+	store, err := openStore(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+
+	sizes := make(map[string]int64)
+	err = store.Iterate(ctx, func(path string, fi FileInfo) error {
+		sizes[path] = fi.Size
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(sizes) == 0 {
+		return nil, fmt.Errorf("namespace %q is empty", ns)
+	}
+	return sizes, nil
+}
+
+// diffSizes 找出只在 newSizes 中、只在 oldSizes 中以及两边大小不同的文件，各自按大小变化从大到小排序
+func diffSizes(oldSizes, newSizes map[string]int64) (added, removed, changed []sizeChange) {
+	for path, size := range newSizes {
+		old, ok := oldSizes[path]
+		switch {
+		case !ok:
+			added = append(added, sizeChange{Path: path, New: size})
+		case old != size:
+			changed = append(changed, sizeChange{Path: path, Old: old, New: size})
+		}
+	}
+	for path, size := range oldSizes {
+		if _, ok := newSizes[path]; !ok {
+			removed = append(removed, sizeChange{Path: path, Old: size})
+		}
+	}
+	for _, list := range [][]sizeChange{added, changed} {
+		sortChanges(list, false)
+	}
+	// 删除的文件大小变化为负，按减少的空间从大到小排序
+	sortChanges(removed, true)
+	return added, removed, changed
+}
+
+// sortChanges 按大小变化从大到小排序，shrinkFirst 为 true 时减少最多的排在前面，变化相同时按路径排序
+func sortChanges(list []sizeChange, shrinkFirst bool) {
+	sort.Slice(list, func(i, j int) bool {
+		di, dj := list[i].delta(), list[j].delta()
+		if shrinkFirst {
+			di, dj = -di, -dj
+		}
+		if di != dj {
+			return di > dj
+		}
+		return list[i].Path < list[j].Path
+	})
+}
+
+// writeDiffSection 写出一组变化：先是 "# 组名: 文件数, 总变化" 的标题行，
+// 随后每行为 "大小变化,旧大小,新大小,路径"，组之间空一行
+func writeDiffSection(w io.Writer, title string, list []sizeChange) {
+	var total int64
+	for _, c := range list {
+		total += c.delta()
+	}
+	sign := "+"
+	if total < 0 {
+		sign, total = "-", -total
+	}
+	fmt.Fprintf(w, "# %s: %d files, %s%s\n", title, len(list), sign, formatBytes(total))
+	for _, c := range list {
+		fmt.Fprintf(w, "%+d,%d,%d,%s\n", c.delta(), c.Old, c.New, csvQuote(c.Path))
+	}
+	fmt.Fprintln(w)
+}
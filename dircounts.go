@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// dirCounts 统计每个目录下直接包含的文件数，不计子目录中的文件，
+// 用来找出缓存目录这类装满小文件的目录
+type dirCounts struct {
+	mu     sync.Mutex
+	counts map[string]int64
+}
+
+func newDirCounts() *dirCounts {
+	return &dirCounts{counts: make(map[string]int64)}
+}
+
+// add 给文件所在的目录计数加一
+func (d *dirCounts) add(path string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.counts[filepath.Dir(path)]++
+}
+
+// saveDirCounts 按文件数从多到少写出文件数不少于 minCount 的目录，每行为 "count,path"；
+// top > 0 时只写前 top 个目录，返回写出的目录数
+func saveDirCounts(dir, filename string, counts *dirCounts, minCount int64, top int, absPaths bool) (int, error) {
+	file, err := createOutputFile(filename)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	counts.mu.Lock()
+	defer counts.mu.Unlock()
+	var dirs []string
+	for d, n := range counts.counts {
+		if n >= minCount {
+			dirs = append(dirs, d)
+		}
+	}
+	sort.Slice(dirs, func(i, j int) bool {
+		if counts.counts[dirs[i]] != counts.counts[dirs[j]] {
+			return counts.counts[dirs[i]] > counts.counts[dirs[j]]
+		}
+		return dirs[i] < dirs[j]
+	})
+	if top > 0 && len(dirs) > top {
+		dirs = dirs[:top]
+	}
+
+	for _, d := range dirs {
+		fmt.Fprintf(file, "%d,%s\n", counts.counts[d], csvQuote(displayPath(dir, d, absPaths)))
+	}
+	return len(dirs), file.commit()
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// dirTotals 累计每个目录下（包括子目录）文件的总大小
+type dirTotals struct {
+	mu    sync.Mutex
+	sizes map[string]int64
+}
+
+func newDirTotals() *dirTotals {
+	return &dirTotals{sizes: make(map[string]int64)}
+}
+
+// add 把文件大小累加到它所在目录以及直到 root 为止的每一级上层目录
+func (d *dirTotals) add(root, path string, size int64) {
+	root = filepath.Clean(root)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for dir := filepath.Dir(path); ; dir = filepath.Dir(dir) {
+		d.sizes[dir] += size
+		if dir == root || dir == filepath.Dir(dir) {
+			break
+		}
+	}
+}
+
+// saveDirTotals 按总大小从大到小写出目录列表，格式与 fav.log 相同；top > 0 时只写前 top 个目录
+func saveDirTotals(dir, filename string, totals *dirTotals, top int, absPaths bool) error {
+	file, err := createOutputFile(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	totals.mu.Lock()
+	defer totals.mu.Unlock()
+	var dirs []string
+	for d := range totals.sizes {
+		dirs = append(dirs, d)
+	}
+	sort.Slice(dirs, func(i, j int) bool {
+		if totals.sizes[dirs[i]] != totals.sizes[dirs[j]] {
+			return totals.sizes[dirs[i]] > totals.sizes[dirs[j]]
+		}
+		return dirs[i] < dirs[j]
+	})
+	if top > 0 && len(dirs) > top {
+		dirs = dirs[:top]
+	}
+
+	for _, d := range dirs {
+		fmt.Fprintf(file, "%d,%s\n", totals.sizes[d], csvQuote(displayPath(dir, d, absPaths)))
+	}
+	return file.commit()
+}
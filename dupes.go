@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"github.com/huangyingw/FileSorter/scanner"
+	"sort"
+	"sync"
+)
+
+// dupeFinder 收集通过大小阈值的文件，按大小分组，用于查找内容重复的文件
+type dupeFinder struct {
+	mu     sync.Mutex
+	bySize map[int64][]string
+}
+
+// dupeGroup 是一组内容相同的文件
+type dupeGroup struct {
+	Hash  string
+	Size  int64
+	Paths []string
+}
+
+// waste 返回这组文件浪费的空间，即保留一份之外其余副本的总大小
+func (g dupeGroup) waste() int64 {
+	return int64(len(g.Paths)-1) * g.Size
+}
+
+func newDupeFinder() *dupeFinder {
+	return &dupeFinder{bySize: make(map[int64][]string)}
+}
+
+func (d *dupeFinder) add(path string, size int64) {
+	d.mu.Lock()
+	d.bySize[size] = append(d.bySize[size], path)
+	d.mu.Unlock()
+}
+
+// findDuplicates 只对大小与其他候选文件相同的文件计算内容哈希，
+// 返回至少有 minCopies 个文件、浪费空间不少于 minWaste 的分组，按浪费的空间从大到小排序。
+// 同时提交的文件数为 workerCount，实际的读取和计算并发由 hasher 的两级工作池限制
+func (d *dupeFinder) findDuplicates(hasher *hashPipeline, workerCount, minCopies int, minWaste int64) []dupeGroup {
+	type key struct {
+		size int64
+		hash string
+	}
+	var mu sync.Mutex
+	byHash := make(map[key][]string)
+
+	taskQueue, poolWg := scanner.NewWorkerPool(workerCount)
+	for size, paths := range d.bySize {
+		// 同样大小的文件全部相同时浪费最多，仍达不到阈值的分组不需要计算哈希
+		if len(paths) < minCopies || int64(len(paths)-1)*size < minWaste {
+			continue
+		}
+		for _, path := range paths {
+			size, path := size, path
+			taskQueue <- func() {
+				hash, err := hasher.hash(path)
+				if err != nil {
+					scanErrors.add("hash", path, err)
+					return
+				}
+				mu.Lock()
+				byHash[key{size, hash}] = append(byHash[key{size, hash}], path)
+				mu.Unlock()
+			}
+		}
+	}
+	close(taskQueue)
+	poolWg.Wait()
+
+	var groups []dupeGroup
+	for k, paths := range byHash {
+		g := dupeGroup{Hash: k.hash, Size: k.size, Paths: paths}
+		if len(paths) < minCopies || g.waste() < minWaste {
+			continue
+		}
+		sort.Strings(paths)
+		groups = append(groups, g)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if wi, wj := groups[i].waste(), groups[j].waste(); wi != wj {
+			return wi > wj
+		}
+		return groups[i].Hash < groups[j].Hash
+	})
+	return groups
+}
+
+// saveDupesToFile 写出重复文件报告：每组先写一行 "hash,size,浪费的空间"，随后每行一个路径，组之间空一行
+func saveDupesToFile(dir, filename string, groups []dupeGroup, absPaths bool) error {
+	file, err := createOutputFile(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	for _, g := range groups {
+		fmt.Fprintf(file, "%s,%d,%d\n", g.Hash, g.Size, g.waste())
+		for _, path := range g.Paths {
+			fmt.Fprintln(file, csvQuote(displayPath(dir, path, absPaths)))
+		}
+		fmt.Fprintln(file)
+	}
+	return file.commit()
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// noExtension 是没有扩展名的文件所在的分组
+const noExtension = "(none)"
+
+// extStat 是一个扩展名下文件的总大小和数量
+type extStat struct {
+	Size  int64
+	Count int64
+}
+
+// extTotals 按小写扩展名累计文件的总大小和数量
+type extTotals struct {
+	mu    sync.Mutex
+	stats map[string]*extStat
+}
+
+func newExtTotals() *extTotals {
+	return &extTotals{stats: make(map[string]*extStat)}
+}
+
+func (e *extTotals) add(path string, size int64) {
+	ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(path), "."))
+	if ext == "" {
+		ext = noExtension
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	st := e.stats[ext]
+	if st == nil {
+		st = &extStat{}
+		e.stats[ext] = st
+	}
+	st.Size += size
+	st.Count++
+}
+
+// extRow 是 sorted 返回的一个扩展名及其统计
+type extRow struct {
+	Ext string
+	extStat
+}
+
+// sorted 按总大小从大到小返回每个扩展名的统计，大小相同时按扩展名排序；top > 0 时只返回前 top 个
+func (e *extTotals) sorted(top int) []extRow {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	rows := make([]extRow, 0, len(e.stats))
+	for ext, st := range e.stats {
+		rows = append(rows, extRow{Ext: ext, extStat: *st})
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].Size != rows[j].Size {
+			return rows[i].Size > rows[j].Size
+		}
+		return rows[i].Ext < rows[j].Ext
+	})
+	if top > 0 && len(rows) > top {
+		rows = rows[:top]
+	}
+	return rows
+}
+
+// saveExtTotals 按总大小从大到小写出每个扩展名一行："size,count,ext"；top > 0 时只写前 top 个
+func saveExtTotals(filename string, totals *extTotals, top int) error {
+	file, err := createOutputFile(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	for _, row := range totals.sorted(top) {
+		fmt.Fprintf(file, "%d,%d,%s\n", row.Size, row.Count, csvQuote(row.Ext))
+	}
+	return file.commit()
+}
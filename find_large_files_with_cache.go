@@ -1,298 +1,1529 @@
 package main
 
 import (
-	"bufio"
 	"bytes"
+	"compress/gzip"
 	"context"
-	"crypto/sha256"
-	"encoding/gob"
 	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
-	"github.com/go-redis/redis/v8"
-	"github.com/karrick/godirwalk"
+	"github.com/huangyingw/FileSorter/scanner"
+	"io"
+	"math"
 	"os"
+	"os/signal"
 	"path/filepath"
-	"regexp"
+	"runtime"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
+	"syscall"
 	"time"
 )
 
-var progressCounter int32 // Progress counter
-var rdb *redis.Client     // Redis client
-var ctx = context.Background()
+var progressCounter int32      // Progress counter
+var bytesCounter int64         // Total size of processed files
+var unchangedCounter int64     // Files whose cached entry was already up to date
+var forceWrite bool            // Rewrite cached entries even if they are unchanged
+var dryRun bool                // Scan without writing to Redis
+var dupes *dupeFinder          // Duplicate candidates, nil unless -find-dupes is set
+var verifier *checksumVerifier // Checksum mismatches, nil unless -verify is set
+var typeDetector *hashPipeline // Reads file headers for content types, nil unless -detect-type is set
 
 // FileInfo holds file information
 type FileInfo struct {
-	Size    int64
-	ModTime time.Time
+	Size     int64
+	ModTime  time.Time
+	Checksum string // Content hash (see -hash-algo), only set by -verify scans
+
+	// UID, GID and permission bits, only set by -capture-owner scans
+	Owner *scanner.Owner
+
+	// MIME type sniffed from the first 512 bytes, only set by -detect-type scans
+	ContentType string
 }
 
-// Task 定义了工作池中的任务类型
-type Task func()
+// Generate a hash of the given string with the -hash-algo algorithm
+func generateHash(s string) string {
+	hasher := newHasher()
+	hasher.Write([]byte(s))
+	return hex.EncodeToString(hasher.Sum(nil))
+}
 
-// NewWorkerPool 创建并返回一个工作池
-func NewWorkerPool(workerCount int) (chan<- Task, *sync.WaitGroup) {
-	var wg sync.WaitGroup
-	taskQueue := make(chan Task)
+// parseSize 解析人类可读的大小，例如 "500M"、"2G" 或纯字节数 "1048576"
+// 支持 K/M/G/T 后缀（按 1024 进制），后缀后可带可选的 "B"
+func parseSize(s string) (int64, error) {
+	str := strings.ToUpper(strings.TrimSpace(s))
+	str = strings.TrimSuffix(str, "B")
+	if str == "" {
+		return 0, fmt.Errorf("empty size")
+	}
 
-	for i := 0; i < workerCount; i++ {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			for task := range taskQueue {
-				task()
-			}
-		}()
+	multiplier := int64(1)
+	switch str[len(str)-1] {
+	case 'K':
+		multiplier = 1 << 10
+	case 'M':
+		multiplier = 1 << 20
+	case 'G':
+		multiplier = 1 << 30
+	case 'T':
+		multiplier = 1 << 40
+	}
+	if multiplier != 1 {
+		str = str[:len(str)-1]
 	}
 
-	return taskQueue, &wg
+	n, err := strconv.ParseInt(str, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	if n > math.MaxInt64/multiplier {
+		return 0, fmt.Errorf("size %q is too large", s)
+	}
+	return n * multiplier, nil
 }
 
-var wg sync.WaitGroup
-var workerPool = make(chan struct{}, 20) // Limit concurrency to 20
-
-// Initialize Redis client
-func init() {
-	rdb = redis.NewClient(&redis.Options{
-		Addr: "localhost:6379",
-	})
-	_, err := rdb.Ping(ctx).Result()
-	if err != nil {
-		fmt.Println("Error connecting to Redis:", err)
-		os.Exit(1)
+// recordScanError 把 scanner 报告的错误记录到 scanErrors
+func recordScanError(e *scanner.Error) {
+	if e.Fatal {
+		scanErrors.addFatal(e.Category, e.Path, e.Err)
+	} else {
+		scanErrors.add(e.Category, e.Path, e.Err)
 	}
 }
 
-// Generate a SHA-256 hash for the given string
-func generateHash(s string) string {
-	hasher := sha256.New()
-	hasher.Write([]byte(s))
-	return hex.EncodeToString(hasher.Sum(nil))
-}
+// stringList 是可以重复指定的字符串参数，例如 -exclude a -exclude b
+type stringList []string
 
-func processDirectory(path string) {
-	// 处理目录的逻辑
-	fmt.Printf("Processing directory: %s\n", path)
-	// 可能的操作：遍历目录下的文件等
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
 }
 
-func processSymlink(path string) {
-	// 处理软链接的逻辑
-	fmt.Printf("Processing symlink: %s\n", path)
-	// 可能的操作：解析软链接，获取实际文件等
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
 }
 
 func loadExcludePatterns(filename string) ([]string, error) {
-	file, err := os.Open(filename)
-	if err != nil {
-		return nil, err
+	patterns, err := scanner.LoadPatterns(filename)
+	for _, pattern := range patterns {
+		verbosef("Loaded exclude pattern: %s\n", pattern) // 打印每个加载的模式
 	}
-	defer file.Close()
+	return patterns, err
+}
+
+// saveOptions 控制 saveToFile 输出哪些记录以及输出格式
+type saveOptions struct {
+	format   string    // csv, json or a comma-separated list such as csv,json
+	top      int       // 只保留排序最靠前的 top 条，0 表示不限制
+	minSize  int64     // 只输出不小于 minSize 的记录
+	maxSize  int64     // 只输出不大于 maxSize 的记录，0 表示不限制
+	absPaths bool      // 输出绝对路径而不是相对输出目录的路径，不在输出目录下的路径总是输出绝对路径
+	compress bool      // 用 gzip 压缩输出文件，文件名追加 ".gz"
+	sorts    []sortKey // 要生成的日志的排序方式，为空时生成 fav.log 和 fav.log.sort
+	reverse  bool      // 反转每个日志的顺序：从小到大、从旧到新或路径倒序
+	output   string    // "-" 表示把日志写到标准输出而不是输出目录中的文件
 
-	var patterns []string
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		pattern := scanner.Text()
-		fmt.Printf("Loaded exclude pattern: %s\n", pattern) // 打印每个加载的模式
-		patterns = append(patterns, pattern)
+	olderThan time.Time // 只输出修改时间早于该时刻的记录，零值表示不限制
+	newerThan time.Time // 只输出修改时间不早于该时刻的记录，零值表示不限制
+}
+
+// timeBound 是 -older-than/-newer-than 的 flag.Value，接受距今的时长或日期
+type timeBound struct {
+	t *time.Time
+}
+
+func (b timeBound) String() string {
+	if b.t == nil || b.t.IsZero() {
+		return ""
 	}
-	return patterns, scanner.Err()
+	return b.t.Format(time.RFC3339)
 }
 
-func saveToFile(dir, filename string, sortByModTime bool) error {
-	file, err := os.Create(filepath.Join(dir, filename))
+func (b timeBound) Set(s string) error {
+	t, err := parseTimeBound(s, time.Now())
 	if err != nil {
 		return err
 	}
-	defer file.Close()
+	*b.t = t
+	return nil
+}
 
-	iter := rdb.Scan(ctx, 0, "*", 0).Iterator()
-	var data = make(map[string]FileInfo)
-	for iter.Next(ctx) {
-		hashedKey := iter.Val()
-		originalPath, err := rdb.Get(ctx, "path:"+hashedKey).Result()
-		if err != nil {
-			continue
+// parseTimeBound 把 "720h"、"30d"、"2w"、"1y" 这样的时长解析为 now 之前的时刻，
+// 或者解析 "2006-01-02"、RFC3339 格式的日期；没有时区的日期按 UTC 处理，结果统一为 UTC
+func parseTimeBound(s string, now time.Time) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(-d).UTC(), nil
+	}
+	units := map[byte]time.Duration{'d': 24 * time.Hour, 'w': 7 * 24 * time.Hour, 'y': 365 * 24 * time.Hour}
+	if len(s) > 1 {
+		if unit, ok := units[s[len(s)-1]]; ok {
+			if n, err := strconv.ParseInt(s[:len(s)-1], 10, 64); err == nil && n >= 0 && n <= int64(math.MaxInt64/unit) {
+				return now.Add(-time.Duration(n) * unit).UTC(), nil
+			}
 		}
-		value, err := rdb.Get(ctx, hashedKey).Bytes()
-		if err != nil {
-			continue
+	}
+	for _, layout := range []string{"2006-01-02", time.RFC3339} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.UTC(), nil
 		}
-		var fileInfo FileInfo
-		buf := bytes.NewBuffer(value)
-		dec := gob.NewDecoder(buf)
-		if err := dec.Decode(&fileInfo); err == nil {
-			data[originalPath] = fileInfo
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q, want a duration such as 720h, 30d or 1y, or a date such as 2006-01-02", s)
+}
+
+// addOutputFlags 注册输出相关的参数，扫描和 report 子命令共用
+func addOutputFlags(fs *flag.FlagSet, opts *saveOptions) {
+	fs.StringVar(&opts.format, "format", "csv", "comma-separated output formats for the logs: csv, json or csv,json to write both from one pass over the cache")
+	fs.BoolVar(&opts.absPaths, "abs-paths", false, "write absolute paths instead of paths relative to the output directory (always on with several roots)")
+	fs.BoolVar(&opts.compress, "compress", false, "gzip the logs and add a .gz suffix")
+	fs.IntVar(&opts.top, "top", 0, "only keep the first N files of each log, 0 means unlimited")
+	fs.StringVar(&opts.output, "o", "", "write the log to stdout instead of files when set to -, only one -sort is allowed; messages go to stderr")
+	fs.BoolVar(&opts.reverse, "reverse", false, "reverse the order of each log: smallest or oldest first, paths in descending order")
+	fs.Var(sortKeyList{&opts.sorts}, "sort", "comma-separated logs to write: size (-out), mtime (-out-sorted), path (fav.log.path); size,mtime when empty")
+	fs.StringVar(&sizeLogName, "out", "fav.log", "name of the log sorted by size, e.g. fav-2024-06.log")
+	fs.StringVar(&mtimeLogName, "out-sorted", "fav.log.sort", "name of the log sorted by modification time, must differ from -out")
+	fs.Var(timeBound{&opts.olderThan}, "older-than", "only list files last modified before this, a duration ago (e.g. 1y, 30d, 720h) or a date (2006-01-02)")
+	fs.Var(timeBound{&opts.newerThan}, "newer-than", "only list files last modified at or after this, a duration ago or a date")
+}
+
+// validateOutputOptions 检查输出参数是否合法
+func validateOutputOptions(opts saveOptions) error {
+	seenFormats := make(map[string]bool)
+	for _, format := range opts.formats() {
+		if format != "csv" && format != "json" {
+			return fmt.Errorf("invalid -format %q", format)
+		}
+		if seenFormats[format] {
+			return fmt.Errorf("-format lists %s more than once", format)
 		}
+		seenFormats[format] = true
+	}
+	if opts.output == "-" && len(seenFormats) > 1 {
+		return fmt.Errorf("-o - writes a single log, use one -format")
 	}
+	if opts.top < 0 {
+		return fmt.Errorf("invalid -top %d", opts.top)
+	}
+	if opts.output != "" && opts.output != "-" {
+		return fmt.Errorf("invalid -o %q, only - (stdout) is supported", opts.output)
+	}
+	if opts.output == "-" && len(opts.sorts) > 1 {
+		return fmt.Errorf("-o - writes a single log, use one -sort")
+	}
+	if !opts.olderThan.IsZero() && !opts.newerThan.IsZero() && !opts.newerThan.Before(opts.olderThan) {
+		return fmt.Errorf("-newer-than must be earlier than -older-than")
+	}
+	return validateLogNames()
+}
+
+// jsonEntry 是 -format json 输出中的一条记录
+type jsonEntry struct {
+	Path    string `json:"path"`
+	Size    int64  `json:"size"`
+	ModTime string `json:"modTime"`
 
-	var keys []string
-	for k := range data {
-		keys = append(keys, k)
+	// 只在记录中有所有者（-capture-owner 扫描）时输出
+	UID  *uint32 `json:"uid,omitempty"`
+	GID  *uint32 `json:"gid,omitempty"`
+	Mode string  `json:"mode,omitempty"`
+
+	ContentType string `json:"contentType,omitempty"` // 只在 -detect-type 扫描的记录中有
+}
+
+// newJSONEntry 把一条记录转换为 JSON 输出的形式，路径按 displayPath 的规则输出
+func newJSONEntry(dir, path string, fi FileInfo, absPaths bool) jsonEntry {
+	entry := jsonEntry{
+		Path:    displayPath(dir, path, absPaths),
+		Size:    fi.Size,
+		ModTime: fi.ModTime.UTC().Format(time.RFC3339),
+	}
+	if o := fi.Owner; o != nil {
+		entry.UID, entry.GID, entry.Mode = &o.UID, &o.GID, o.Mode.String()
 	}
+	entry.ContentType = fi.ContentType
+	return entry
+}
 
-	sortKeys(keys, data, sortByModTime)
+// formats 返回 -format 中逗号分隔的各个格式
+func (opts saveOptions) formats() []string {
+	var formats []string
+	for _, f := range strings.Split(opts.format, ",") {
+		formats = append(formats, strings.TrimSpace(f))
+	}
+	return formats
+}
 
-	for _, k := range keys {
-		relativePath, _ := filepath.Rel(dir, k)
-		if sortByModTime {
-			utcTimestamp := data[k].ModTime.UTC().Unix()
-			fmt.Fprintf(file, "%d,\"./%s\"\n", utcTimestamp, relativePath)
+// outputFilename 返回 format 格式的输出文件的名字，json 格式追加 ".json" 后缀，压缩时再追加 ".gz"
+func outputFilename(filename, format string, opts saveOptions) string {
+	if format == "json" {
+		filename += ".json"
+	}
+	if opts.compress {
+		filename += ".gz"
+	}
+	return filename
+}
+
+// collectEntries 遍历一次存储，取出通过 opts 过滤的记录，返回记录和每种排序方式下排好序的路径；
+// opts.top > 0 时每种排序方式只保留最靠前的 top 条，data 中只有这些记录
+func collectEntries(ctx context.Context, store Store, sorts []sortKey, opts saveOptions) (map[string]FileInfo, map[sortKey][]string, error) {
+	var data = make(map[string]FileInfo)
+	var topEntries []*topHeap
+	if opts.top > 0 {
+		for _, key := range sorts {
+			topEntries = append(topEntries, newTopHeap(opts.top, key, opts.reverse))
+		}
+	}
+	err := store.Iterate(ctx, func(path string, fileInfo FileInfo) error {
+		if !opts.inSizeRange(fileInfo.Size) {
+			return nil
+		}
+		modTime := fileInfo.ModTime.UTC()
+		if !opts.olderThan.IsZero() && !modTime.Before(opts.olderThan) {
+			return nil
+		}
+		if !opts.newerThan.IsZero() && modTime.Before(opts.newerThan) {
+			return nil
+		}
+		if topEntries != nil {
+			for _, h := range topEntries {
+				h.offer(fileEntry{Path: path, Info: fileInfo})
+			}
 		} else {
-			fmt.Fprintf(file, "%d,\"./%s\"\n", data[k].Size, relativePath)
+			data[path] = fileInfo
 		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
 	}
-	return nil
+
+	sorted := make(map[sortKey][]string, len(sorts))
+	for i, key := range sorts {
+		var keys []string
+		if topEntries != nil {
+			for _, e := range topEntries[i].entries {
+				data[e.Path] = e.Info
+				keys = append(keys, e.Path)
+			}
+		} else {
+			keys = make([]string, 0, len(data))
+			for k := range data {
+				keys = append(keys, k)
+			}
+		}
+		sortKeys(keys, data, key, opts.reverse)
+		sorted[key] = keys
+	}
+	return data, sorted, nil
 }
 
-func sortKeys(keys []string, data map[string]FileInfo, sortByModTime bool) {
-	if sortByModTime {
-		sort.Slice(keys, func(i, j int) bool {
-			return data[keys[i]].ModTime.After(data[keys[j]].ModTime)
-		})
+// inSizeRange 判断大小为 size 的记录是否在 minSize 和 maxSize 之间，日志、运行报告和汇总中的最大文件都用它过滤
+func (o saveOptions) inSizeRange(size int64) bool {
+	return size >= o.minSize && (o.maxSize <= 0 || size <= o.maxSize)
+}
+
+// saveToFile 把排好序的记录按 format 写入文件，filename 为 "-" 时写到标准输出
+func saveToFile(dir, filename, format string, keys []string, data map[string]FileInfo, key sortKey, opts saveOptions) error {
+	var out io.Writer = os.Stdout
+	var file *atomicFile
+	if filename != "-" {
+		var err error
+		if file, err = createOutputFile(filename); err != nil {
+			return err
+		}
+		defer file.Close()
+		out = file
+	}
+
+	w := out
+	var gz *gzip.Writer
+	if opts.compress {
+		gz = gzip.NewWriter(out)
+		w = gz
+	}
+	var err error
+	if format == "json" {
+		err = writeJSON(w, dir, keys, data, opts.absPaths)
 	} else {
-		sort.Slice(keys, func(i, j int) bool {
-			return data[keys[i]].Size > data[keys[j]].Size
-		})
+		err = writeCSV(w, dir, keys, data, key, opts.absPaths)
+	}
+	if err != nil {
+		return err
+	}
+	// gzip.Writer 需要先关闭，把缓冲的数据和 gzip 尾部写入文件，然后才能关闭文件
+	if gz != nil {
+		if err := gz.Close(); err != nil {
+			return err
+		}
+	}
+	if file == nil {
+		return nil
 	}
+	return file.commit()
 }
 
-func processFile(path string, typ os.FileMode) {
-	if typ.IsDir() {
-		return
+// writeCSV 每行写出一条记录：按修改时间排序时为 "UTC 时间戳,path"，其他排序方式为 "size,path"
+func writeCSV(w io.Writer, dir string, keys []string, data map[string]FileInfo, key sortKey, absPaths bool) error {
+	for _, k := range keys {
+		path := csvQuote(displayPath(dir, k, absPaths))
+		value := data[k].Size
+		if key == sortMtime {
+			value = data[k].ModTime.UTC().Unix()
+		}
+		if _, err := fmt.Fprintf(w, "%d,%s\n", value, path); err != nil {
+			return err
+		}
 	}
+	return nil
+}
 
-	info, err := os.Stat(path)
-	if err != nil {
-		fmt.Printf("Error stating file: %s, Error: %s\n", path, err)
+// csvQuote 按 CSV 规则给字段加引号，字段中的双引号写成 ""
+func csvQuote(s string) string {
+	return "\"" + strings.ReplaceAll(s, "\"", "\"\"") + "\""
+}
+
+// saveLogs 按 opts.sorts 中的每种排序方式和 -format 中的每种格式各生成一个日志，
+// 默认生成 fav.log（按大小排序）和 fav.log.sort（按修改时间排序）；存储只遍历一次，所有日志共用读出的记录。
+// -o - 时只把第一种排序方式的日志写到标准输出；保存失败的文件作为严重错误记录到 scanErrors
+func saveLogs(ctx context.Context, store Store, dir string, opts saveOptions) {
+	sorts := opts.sorts
+	if len(sorts) == 0 {
+		sorts = defaultSortKeys
+	}
+	if opts.output == "-" {
+		sorts = sorts[:1]
+	}
+	data, keys, err := collectEntries(ctx, store, sorts, opts)
+	if opts.output == "-" {
+		if err == nil {
+			err = saveToFile(dir, "-", opts.formats()[0], keys[sorts[0]], data, sorts[0], opts)
+		}
+		if err != nil {
+			scanErrors.addFatal("save", "stdout", err)
+		}
 		return
 	}
+	for _, key := range sorts {
+		for _, format := range opts.formats() {
+			logName := outputFilename(key.logName(), format, opts)
+			saveErr := err
+			if saveErr == nil {
+				saveErr = saveToFile(dir, logName, format, keys[key], data, key, opts)
+			}
+			if saveErr != nil {
+				scanErrors.addFatal("save", logName, saveErr)
+			} else {
+				infof("Saved data to %s\n", outputPath(logName))
+			}
+		}
+	}
+}
 
+// writeJSON 把排好序的记录写成一个 JSON 数组，每个元素占一行
+func writeJSON(w io.Writer, dir string, keys []string, data map[string]FileInfo, absPaths bool) error {
 	var buf bytes.Buffer
-	enc := gob.NewEncoder(&buf)
-	if err := enc.Encode(FileInfo{Size: info.Size(), ModTime: info.ModTime()}); err != nil {
-		fmt.Printf("Error encoding: %s, File: %s\n", err, path)
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+
+	buf.WriteString("[\n")
+	for i, k := range keys {
+		buf.WriteString("  ")
+		if err := enc.Encode(newJSONEntry(dir, k, data[k], absPaths)); err != nil {
+			return err
+		}
+		// Encode 总是以换行结尾，需要在换行前补上逗号
+		if i < len(keys)-1 {
+			buf.Truncate(buf.Len() - 1)
+			buf.WriteString(",\n")
+		}
+		if _, err := w.Write(buf.Bytes()); err != nil {
+			return err
+		}
+		buf.Reset()
+	}
+	buf.WriteString("]\n")
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func sortKeys(keys []string, data map[string]FileInfo, key sortKey, reverse bool) {
+	sort.Slice(keys, func(i, j int) bool {
+		return entryLess(fileEntry{keys[i], data[keys[i]]}, fileEntry{keys[j], data[keys[j]]}, key, reverse)
+	})
+}
+
+// logFile 输出一个文件的处理结果：文本模式下是一行调试信息，-log-json 时是带有 FileInfo 字段的 "file" 事件
+func logFile(status, path string, info FileInfo) {
+	if jsonLogFlag {
+		fields := map[string]interface{}{
+			"status": status, "path": path, "size": info.Size, "mtime": info.ModTime.UTC().Format(time.RFC3339),
+		}
+		if o := info.Owner; o != nil {
+			fields["uid"], fields["gid"], fields["mode"] = o.UID, o.GID, o.Mode.String()
+		}
+		if info.ContentType != "" {
+			fields["content_type"] = info.ContentType
+		}
+		logEvent(levelVerbose, "file", fields)
+		return
+	}
+	verbosef("%s file: %s (%s)\n", strings.ToUpper(status[:1])+status[1:], path, formatBytes(info.Size))
+}
+
+// stopScan 在存储不可用时停止遍历，由 runScan 设置为停止扫描的 cancel 函数
+var stopScan context.CancelFunc
+
+// fileLimit 是 -limit 设置的文件数，记录这么多文件后停止遍历，0 表示不限制
+var fileLimit int32
+
+// limitReached 在已记录的文件数达到 fileLimit 时置为 1
+var limitReached int32
+
+// storeFailed 在第一次遇到 errStoreUnavailable 时置为 1，之后的文件不再重复报告
+var storeFailed int32
+
+// storeUnavailableCounter 是存储不可用之后扫描到的文件数，这些文件不逐个报告错误，只在结束时汇总一次；
+// 存储缓冲中的记录仍可能在 Flush 时写入，最终没有写入的记录由 Flush 的错误报告
+var storeUnavailableCounter int64
+
+// storeUnavailable 报告存储不可用并停止扫描，与收到 SIGINT 一样保存已有的结果；每次扫描只报告一次
+func storeUnavailable(err error) {
+	if !atomic.CompareAndSwapInt32(&storeFailed, 0, 1) {
 		return
 	}
+	errorf("Store is unavailable, stopping the scan: %s\n", err)
+	scanErrors.addFatal("store", "", err)
+	stopScan()
+}
+
+// processFile 处理扫描找到的一个文件：记录重复文件候选，并把大小和修改时间写入存储
+func processFile(ctx context.Context, store Store, f scanner.FileInfo) {
+	path := f.Path
+	// 远程文件和压缩包中的文件只记录大小和修改时间，不在本地读取内容计算哈希
+	remote := scanner.IsRemote(path) || scanner.IsArchiveEntry(path)
 
-	// Generate hash for the file path
-	hashedKey := generateHash(path)
+	if dupes != nil && !remote {
+		dupes.add(path, f.Size)
+	}
 
-	// 使用管道批量处理Redis命令
-	pipe := rdb.Pipeline()
+	// dry-run 模式下只统计，不写入 Redis
+	if dryRun {
+		countFile(path, FileInfo{Size: f.Size, ModTime: f.ModTime, Owner: f.Owner})
+		return
+	}
 
-	// 这里我们添加命令到管道，但不立即检查错误
-	pipe.Set(ctx, hashedKey, buf.Bytes(), 0)
-	pipe.Set(ctx, "path:"+hashedKey, path, 0)
+	// 缓存中已有相同大小和修改时间的记录时保留其中的校验和，并且跳过写入；
+	// 设置了 -force 或 -cache-ttl 时仍然重写，后者用来刷新过期时间。
+	// -capture-owner 时所有者或权限变化也需要重写，没有设置时保留缓存中原有的所有者
+	fileInfo := FileInfo{Size: f.Size, ModTime: f.ModTime, Owner: f.Owner}
+	cached, ok, err := store.Get(ctx, path)
+	unchanged := err == nil && ok && cached.Size == fileInfo.Size && cached.ModTime.Equal(fileInfo.ModTime)
+	if unchanged && captureOwner && !sameOwner(cached.Owner, fileInfo.Owner) {
+		unchanged = false
+	}
+	if unchanged {
+		fileInfo.Checksum = cached.Checksum
+		fileInfo.Owner = cached.Owner
+		fileInfo.ContentType = cached.ContentType
+	}
+	// 内容类型只在文件变化或缓存中还没有时读取文件开头判断
+	if typeDetector != nil && !remote && fileInfo.ContentType == "" {
+		fileInfo.ContentType = typeDetector.detectType(path)
+		unchanged = false
+	}
+	if verifier != nil && !remote {
+		checksum, ok := verifier.check(path, fileInfo.Checksum, unchanged)
+		if !ok {
+			// 保留缓存中原来的校验和，之后的扫描会继续报告这个文件
+			countFile(path, fileInfo)
+			return
+		}
+		if checksum != fileInfo.Checksum {
+			fileInfo.Checksum = checksum
+			unchanged = false
+		}
+	}
+	if unchanged && !forceWrite && cacheTTL == 0 {
+		logFile("unchanged", path, fileInfo)
+		atomic.AddInt64(&unchangedCounter, 1)
+		countFile(path, fileInfo)
+		return
+	}
 
-	if _, err = pipe.Exec(ctx); err != nil {
-		fmt.Printf("Error executing pipeline for file: %s: %s\n", path, err)
+	if err := store.Put(ctx, path, fileInfo); err != nil {
+		// 扫描被取消时正在执行的写入会失败，不必逐个报错
+		if ctx.Err() != nil {
+			return
+		}
+		if errors.Is(err, errStoreUnavailable) {
+			atomic.AddInt64(&storeUnavailableCounter, 1)
+			storeUnavailable(err)
+			return
+		}
+		scanErrors.add("store", path, err)
 		return
 	}
+	logFile("recorded", path, fileInfo)
 
 	// Update progress counter atomically
-	atomic.AddInt32(&progressCounter, 1)
+	countFile(path, fileInfo)
 }
 
 func main() {
-	if len(os.Args) < 2 {
-		fmt.Println("Usage: ./find_large_files_with_cache <directory>")
-		return
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "report":
+			runReport(os.Args[2:])
+			return
+		case "prune":
+			runPrune(os.Args[2:])
+			return
+		case "gc":
+			runGC(os.Args[2:])
+			return
+		case "migrate":
+			runMigrate(os.Args[2:])
+			return
+		case "diff":
+			runDiff(os.Args[2:])
+			return
+		}
 	}
+	os.Exit(runWatch())
+}
 
-	// Root directory to start the search
-	rootDir := os.Args[1]
+// runScan 遍历根目录并把结果写入存储和日志，返回进程的退出码
+func runScan() int {
+	var outputOpts saveOptions
+	minSizeFlag := flag.String("min-size", "200M", "minimum file size to record, e.g. 500M, 2G or a byte count; 0 records every file")
+	maxSizeFlag := flag.String("max-size", "", "maximum file size to record, e.g. 1G; together with -min-size selects a size range; empty means no upper limit")
+	sizeMode := flag.String("apparent-vs-allocated", "apparent", "which size to filter on and record: apparent (the logical size) or allocated (disk space actually used, blocks*512, much smaller for sparse files such as VM images)")
+	failIfOver := flag.String("fail-if-over", "", "exit with status 3 if the matched files add up to more than this, e.g. 500G; empty disables the check")
+	allFiles := flag.Bool("all", false, "record every file regardless of size for a full inventory, same as -min-size 0; unchanged files are still not rewritten")
+	var sizeRuleFlags sizeRules
+	flag.Var(&sizeRuleFlags, "rule", "minimum size for one extension instead of -min-size, e.g. 'ext=log,min=10M'; may be repeated")
+	sizeRulesFile := flag.String("rules-file", "", "file with one -rule per line; -rule flags override it for the same extension")
+	addStoreFlags(flag.CommandLine)
+	addOutputFlags(flag.CommandLine, &outputOpts)
+	addOutDirFlag(flag.CommandLine)
+	addLogFlags(flag.CommandLine)
+	var excludeFlags stringList
+	excludeIgnoreCase := flag.Bool("exclude-ignore-case", false, "match -exclude and -exclude-file patterns case-insensitively, e.g. on macOS or Windows")
+	excludeFile := flag.String("exclude-file", "", "file with wildcard exclude patterns, one per line, same rules as -exclude; replaces the exclude_patterns.txt read from each root and must exist (default exclude_patterns.txt in each root, optional)")
+	flag.Var(&excludeFlags, "exclude", "wildcard exclude pattern: without a / it matches file and directory names, e.g. 'node_modules' or '*.tmp', otherwise the path relative to the root, e.g. 'cache/*'; may be repeated")
+	ignoreFile := flag.String("ignore-file", ".scanignore", "name of per-directory files whose wildcard patterns apply only below that directory, like .gitignore; empty disables")
+	var includeFlags stringList
+	includeFile := flag.String("include-file", "", "file with wildcard include patterns, one per line")
+	flag.Var(&includeFlags, "include", "only record files whose whole path matches this wildcard pattern, e.g. '*.mkv'; may be repeated")
+	excludeExt := flag.String("exclude-ext", "", "comma-separated list of file extensions to skip, e.g. iso,tmp,part")
+	scanArchives := flag.Bool("scan-archives", false, "also record the files inside .zip, .tar, .tar.gz and .tgz archives as archive.zip!/inner/path, with sizes from the archive headers and without extracting; nested archives are not opened")
+	skipFSTypes := flag.String("skip-fstypes", "", "comma-separated filesystem types whose mounts are skipped entirely, as named in /proc/mounts, e.g. nfs,nfs4,tmpfs (Linux only)")
+	findDupes := flag.Bool("find-dupes", false, "find duplicate files by content hash and write them to fav.log.dupes")
+	dupeMinCopies := flag.Int("dupe-min-copies", 2, "only report duplicate groups with at least this many copies")
+	dupeMinWaste := flag.String("dupe-min-waste", "0", "only report duplicate groups wasting at least this much space, (copies-1)*size, e.g. 1G")
+	detectType := flag.Bool("detect-type", false, "sniff each file's MIME type from its first 512 bytes and keep it in the cache and in -format json output; unreadable files get \"unknown\"")
+	flag.BoolVar(&captureOwner, "capture-owner", false, "record each file's UID, GID and permission bits in the cache and in -format json output")
+	flag.BoolVar(&forceWrite, "force", false, "rewrite every cached entry instead of skipping files whose size and modification time are unchanged")
+	verify := flag.Bool("verify", false, "store content checksums and report files whose content changed while size and mtime did not to fav.log.verify")
+	stream := flag.Bool("stream", false, "print each matched file to stdout as size,path as soon as it is processed, before the logs are written; messages go to stderr")
+	pathListFlag := flag.String("path-list", "", "only write the path of each matching file, one per line, to this file (- for stdout), e.g. for xargs; nothing is stored and no logs are written")
+	countOnly := flag.Bool("count-only", false, "only print how many files pass the filters and their total size; nothing is written")
+	flag.BoolVar(&dryRun, "dry-run", false, "walk and count matching files without writing to the store or saving logs")
+	flag.DurationVar(&cacheTTL, "cache-ttl", 0, "expire cached entries after this long, e.g. 720h; 0 never expires (redis store only)")
+	flag.IntVar(&redisBatchSize, "redis-batch-size", 100, "write this many files per Redis pipeline, 1 writes each file on its own (redis store only)")
+	flag.DurationVar(&batchWait, "redis-batch-wait", 100*time.Millisecond, "longest time a file waits in the Redis batch before it is written, 0 only writes full batches")
+	flag.StringVar(&humanMode, "human", "auto", "print an aligned summary with the largest files and duplicates: auto (only on a terminal), always or never; colored on a terminal unless NO_COLOR is set")
+	dedupeRootsFlag := flag.Bool("dedupe-roots", true, "drop roots that repeat or lie inside another root, comparing absolute paths with symlinks resolved, so no file is counted twice")
+	flag.StringVar(&metricsAddr, "metrics-addr", "", "serve Prometheus metrics (files, bytes, errors, Redis write time) on this address while scanning, e.g. :9090; kept up between -watch passes")
+	configFile := flag.String("config", "", "read options from this JSON file, keyed by flag name plus \"roots\"; flags and REDIS_* environment variables take precedence")
+	printConfigFlag := flag.Bool("print-config", false, "print the effective settings as key=value lines, after defaults and environment variables are applied, and exit without scanning or creating any files")
+	noCache := flag.Bool("no-cache", false, "keep matched files only in memory and sort them there, same as -store none; no cache is read or written")
+	resume := flag.Bool("resume", false, "skip directories an interrupted scan already finished, as listed in fav.log.checkpoint; totals and dupes then only cover the rest")
+	flag.DurationVar(&watchInterval, "watch", 0, "rescan every interval until interrupted, e.g. 10m, rewriting the logs and dropping entries of deleted files each pass; 0 scans once")
+	limit := flag.Int("limit", 0, "stop walking after about N matching files are recorded and save them, for a quick preview; files already being processed are still recorded, so a few more than N may be saved; 0 means no limit")
+	maxDuration := flag.Duration("max-duration", 0, "stop walking after this long and save what was cached so far, like an interrupt, e.g. 10m; 0 means no limit")
+	dedupeHardlinks := flag.Bool("dedupe-hardlinks", false, "record only the first path seen for files with several hard links")
+	followSymlinks := flag.Bool("follow-symlinks", false, "resolve symlinks to files and record their targets if large enough")
+	progressFile := flag.String("progress-file", "", "overwrite this file with the latest progress every second instead of printing it, ends with a Done line")
+	precount := flag.Bool("precount", false, "count entries in a quick first pass to show a percentage and ETA")
+	rootsFrom := flag.String("roots", "", "read additional newline-separated root directories from this file, - for stdin")
+	skipHidden := flag.Bool("skip-hidden", false, "skip files and directories whose name starts with a dot")
+	maxDepth := flag.Int("max-depth", -1, "do not descend more than N directory levels below a root, 0 only lists its immediate children; negative means unlimited")
+	dirTotalsFlag := flag.Bool("dir-totals", false, "write total file size per directory to fav.log.dirs")
+	dirMinSize := flag.String("dir-min-size", "0", "only count files at least this large towards -dir-totals")
+	minFileCount := flag.Int64("min-file-count", 0, "write directories directly containing at least this many files, of any size, to fav.log.counts; 0 disables")
+	byExt := flag.Bool("by-ext", false, "write total size and count per file extension to fav.log.ext")
+	extMinSize := flag.String("ext-min-size", "0", "only count files at least this large towards -by-ext")
+	profileStats := flag.Int("profile-stats", 0, "time every lstat during the walk and print the N slowest paths at the end, 0 disables timing")
+	benchmark := flag.Bool("benchmark", false, "walk the roots once per worker count in -benchmark-workers without writing anything and report the throughput of each")
+	var benchmarkCounts intList = []int{1, 2, 4, 8, 16, 32}
+	flag.Var(&benchmarkCounts, "benchmark-workers", "comma-separated worker counts tried by -benchmark")
+	writeMeta := flag.Bool("meta", false, "write the scan settings and totals to fav.log.meta as JSON")
+	jsonReport := flag.Bool("json-config", false, "write one JSON run report to "+runReportName+" with the summary, the largest files (-top of them, default 10) and, when enabled, the -by-ext totals and -find-dupes groups")
+	workersFlag := flag.Int("workers", runtime.NumCPU(), "number of concurrent workers (<= 0 uses the number of CPUs)")
+	ioWorkersFlag := flag.Int("io-workers", 0, "concurrent file reads when hashing for -find-dupes and -verify (<= 0 uses -workers)")
+	hashWorkersFlag := flag.Int("hash-workers", 0, "concurrent hash computations for -find-dupes and -verify (<= 0 uses the number of CPUs)")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "Usage: ./find_large_files_with_cache [options] <directory or sftp://user@host/path>...")
+		fmt.Fprintln(flag.CommandLine.Output(), "       ./find_large_files_with_cache report [options] <directory>...")
+		fmt.Fprintln(flag.CommandLine.Output(), "       ./find_large_files_with_cache prune [options] <directory>...")
+		fmt.Fprintln(flag.CommandLine.Output(), "       ./find_large_files_with_cache gc [options] <directory>...")
+		fmt.Fprintln(flag.CommandLine.Output(), "       ./find_large_files_with_cache migrate [options] <directory>...")
+		fmt.Fprintln(flag.CommandLine.Output(), "       ./find_large_files_with_cache diff [options] <old fav.log> <new fav.log>")
+		flag.PrintDefaults()
+		fmt.Fprintln(flag.CommandLine.Output(), "Exit status: 0 success, 1 errors while scanning or saving, 2 invalid usage, 3 over the -fail-if-over budget")
+	}
+	flag.Parse()
 
-	// Minimum file size in bytes
-	minSize := 200 // Default size is 200MB
-	minSizeBytes := int64(minSize * 1024 * 1024)
+	var configRoots []string
+	if *configFile != "" {
+		var err error
+		if configRoots, err = applyConfigFile(flag.CommandLine, *configFile); err != nil {
+			fmt.Fprintf(flag.CommandLine.Output(), "Invalid -config: %s\n", err)
+			flag.Usage()
+			return 2
+		}
+	}
 
-	excludePatterns, err := loadExcludePatterns(filepath.Join(rootDir, "exclude_patterns.txt"))
-	if err != nil {
-		fmt.Println("Warning: Could not read exclude patterns:", err)
+	if err := applyLogFlags(); err != nil {
+		fmt.Fprintln(flag.CommandLine.Output(), err)
+		flag.Usage()
+		return 2
+	}
+	// -count-only 与 -dry-run 一样不打开存储也不写日志，只是最后的输出不同
+	// -path-list 同样不使用存储，通过过滤的路径直接写入列表
+	if *countOnly || *pathListFlag != "" {
+		dryRun = true
 	}
 
-	excludeRegexps := make([]*regexp.Regexp, len(excludePatterns))
-	for i, pattern := range excludePatterns {
-		// 将通配符模式转换为正则表达式
-		regexPattern := strings.Replace(pattern, "*", ".*", -1)
-		excludeRegexps[i], err = regexp.Compile(regexPattern)
+	// Root directories to start the search
+	// 命令行上没有给出时使用配置文件中的 roots
+	roots := flag.Args()
+	if len(roots) == 0 {
+		roots = configRoots
+	}
+	if *rootsFrom != "" {
+		listed, err := readRootList(*rootsFrom)
 		if err != nil {
-			fmt.Printf("Invalid regex pattern '%s': %s\n", regexPattern, err)
-			return
+			errorf("Error reading root list: %s\n", err)
+			return 1
+		}
+		roots = append(roots, listed...)
+	}
+	if len(roots) == 0 {
+		flag.Usage()
+		return 2
+	}
+	if *dedupeRootsFlag {
+		var dropped []redundantRoot
+		roots, dropped = dedupeRoots(roots)
+		for _, d := range dropped {
+			diagf("Warning: Skipping root %s, it is already covered by %s\n", d.Root, d.Inside)
 		}
 	}
+	if len(roots) > 1 {
+		var err error
+		if roots, err = absRoots(roots); err != nil {
+			errorf("Error resolving root directory: %s\n", err)
+			return 1
+		}
+		outputOpts.absPaths = true
+	}
+	baseDir := pathBase(roots)
 
-	// Start a goroutine to periodically print progress
-	go func() {
-		for {
-			time.Sleep(1 * time.Second)
-			fmt.Printf("Progress: %d files processed.\n", atomic.LoadInt32(&progressCounter))
+	// Minimum file size in bytes; -min-size takes a unit suffix (default 200M = 200 MiB)
+	// and parseSize multiplies in int64 with an overflow check, so thresholds like 4096M are exact
+	minSizeBytes, err := parseSize(*minSizeFlag)
+	if err != nil {
+		fmt.Fprintf(flag.CommandLine.Output(), "Invalid -min-size: %s\n", err)
+		flag.Usage()
+		return 2
+	}
+	if *allFiles {
+		minSizeSet := false
+		flag.Visit(func(f *flag.Flag) {
+			if f.Name == "min-size" {
+				minSizeSet = true
+			}
+		})
+		if minSizeSet {
+			fmt.Fprintln(flag.CommandLine.Output(), "-all and -min-size are mutually exclusive")
+			flag.Usage()
+			return 2
 		}
-	}()
+		if len(sizeRuleFlags) > 0 || *sizeRulesFile != "" {
+			fmt.Fprintln(flag.CommandLine.Output(), "-all records every file, it cannot be combined with -rule or -rules-file")
+			flag.Usage()
+			return 2
+		}
+		// 所有文件都会写入存储，未变化文件的跳过逻辑照常生效，重复扫描时不会重写整个缓存
+		minSizeBytes = 0
+	}
 
-	// Use godirwalk.Walk instead of fastwalk.Walk or filepath.Walk
-	// 初始化工作池
-	workerCount := 20 // 可以根据需要调整工作池的大小
-	taskQueue, poolWg := NewWorkerPool(workerCount)
-
-	// 使用 godirwalk.Walk 遍历文件
-	err = godirwalk.Walk(rootDir, &godirwalk.Options{
-		Callback: func(osPathname string, de *godirwalk.Dirent) error {
-			// 排除模式匹配
-			for _, re := range excludeRegexps {
-				if re.MatchString(osPathname) {
-					return nil
-				}
+	if *noCache {
+		storeSet := false
+		flag.Visit(func(f *flag.Flag) {
+			if f.Name == "store" {
+				storeSet = true
+			}
+		})
+		if storeSet && storeType != "none" && storeType != "memory" {
+			fmt.Fprintf(flag.CommandLine.Output(), "-no-cache cannot be combined with -store %s\n", storeType)
+			flag.Usage()
+			return 2
+		}
+		storeType = "none"
+	}
+
+	// 缓存中可能有以前的扫描记录的更大文件，日志同样按 -max-size 过滤
+	if *maxSizeFlag != "" {
+		if outputOpts.maxSize, err = parseSize(*maxSizeFlag); err != nil {
+			fmt.Fprintf(flag.CommandLine.Output(), "Invalid -max-size: %s\n", err)
+			flag.Usage()
+			return 2
+		}
+		if outputOpts.maxSize < minSizeBytes {
+			fmt.Fprintln(flag.CommandLine.Output(), "-max-size must not be smaller than -min-size")
+			flag.Usage()
+			return 2
+		}
+	}
+	if *sizeMode != "apparent" && *sizeMode != "allocated" {
+		fmt.Fprintf(flag.CommandLine.Output(), "Invalid -apparent-vs-allocated %q, want apparent or allocated\n", *sizeMode)
+		flag.Usage()
+		return 2
+	}
+
+	budget := int64(-1)
+	if *failIfOver != "" {
+		if budget, err = parseSize(*failIfOver); err != nil {
+			fmt.Fprintf(flag.CommandLine.Output(), "Invalid -fail-if-over: %s\n", err)
+			flag.Usage()
+			return 2
+		}
+	}
+
+	// 规则文件中的规则先生效，-rule 对同一扩展名覆盖规则文件
+	extMinSizes := sizeRules{}
+	if *sizeRulesFile != "" {
+		if extMinSizes, err = loadSizeRules(*sizeRulesFile); err != nil {
+			fmt.Fprintf(flag.CommandLine.Output(), "Invalid -rules-file: %s\n", err)
+			flag.Usage()
+			return 2
+		}
+	}
+	for ext, size := range sizeRuleFlags {
+		extMinSizes[ext] = size
+	}
+	// 日志按 -min-size 和 -max-size 过滤缓存中以前的扫描记录的文件；-rule 可以给某些扩展名更小的下限，
+	// 所以日志的下限取其中最小的一个，本次扫描按规则记录的文件都会出现在日志中
+	outputOpts.minSize = minSizeBytes
+	for _, size := range extMinSizes {
+		if size < outputOpts.minSize {
+			outputOpts.minSize = size
+		}
+	}
+
+	if err := validateOutputOptions(outputOpts); err != nil {
+		fmt.Fprintln(flag.CommandLine.Output(), err)
+		flag.Usage()
+		return 2
+	}
+	if humanMode != "auto" && humanMode != "always" && humanMode != "never" {
+		fmt.Fprintf(flag.CommandLine.Output(), "Invalid -human %q, want auto, always or never\n", humanMode)
+		flag.Usage()
+		return 2
+	}
+	if *limit < 0 || *limit > math.MaxInt32 {
+		fmt.Fprintf(flag.CommandLine.Output(), "Invalid -limit %d\n", *limit)
+		flag.Usage()
+		return 2
+	}
+	fileLimit = int32(*limit)
+	if *stream && outputOpts.output == "-" {
+		fmt.Fprintln(flag.CommandLine.Output(), "-stream and -o - both write to stdout, use one of them")
+		flag.Usage()
+		return 2
+	}
+	if *stream && *pathListFlag == "-" {
+		fmt.Fprintln(flag.CommandLine.Output(), "-stream and -path-list - both write to stdout, use one of them")
+		flag.Usage()
+		return 2
+	}
+	if outputOpts.output == "-" || *stream || *pathListFlag == "-" {
+		logOutput = os.Stderr
+	}
+	dirMinSizeBytes, err := parseSize(*dirMinSize)
+	if err != nil {
+		fmt.Fprintf(flag.CommandLine.Output(), "Invalid -dir-min-size: %s\n", err)
+		flag.Usage()
+		return 2
+	}
+
+	if *minFileCount < 0 {
+		fmt.Fprintln(flag.CommandLine.Output(), "-min-file-count must not be negative")
+		flag.Usage()
+		return 2
+	}
+
+	extMinSizeBytes, err := parseSize(*extMinSize)
+	if err != nil {
+		fmt.Fprintf(flag.CommandLine.Output(), "Invalid -ext-min-size: %s\n", err)
+		flag.Usage()
+		return 2
+	}
+
+	dupeMinWasteBytes, err := parseSize(*dupeMinWaste)
+	if err != nil {
+		fmt.Fprintf(flag.CommandLine.Output(), "Invalid -dupe-min-waste: %s\n", err)
+		flag.Usage()
+		return 2
+	}
+	if *dupeMinCopies < 2 {
+		fmt.Fprintf(flag.CommandLine.Output(), "Invalid -dupe-min-copies %d, must be at least 2\n", *dupeMinCopies)
+		flag.Usage()
+		return 2
+	}
+
+	if cacheTTL < 0 {
+		fmt.Fprintf(flag.CommandLine.Output(), "Invalid -cache-ttl: %s\n", cacheTTL)
+		flag.Usage()
+		return 2
+	}
+	if redisBatchSize < 1 || batchWait < 0 {
+		fmt.Fprintf(flag.CommandLine.Output(), "Invalid -redis-batch-size %d or -redis-batch-wait %s\n", redisBatchSize, batchWait)
+		flag.Usage()
+		return 2
+	}
+	if *profileStats < 0 {
+		fmt.Fprintf(flag.CommandLine.Output(), "Invalid -profile-stats %d\n", *profileStats)
+		flag.Usage()
+		return 2
+	}
+	if *resume && forceWrite {
+		fmt.Fprintln(flag.CommandLine.Output(), "-resume and -force are mutually exclusive, -force always rescans everything")
+		flag.Usage()
+		return 2
+	}
+	if *maxDuration < 0 {
+		fmt.Fprintf(flag.CommandLine.Output(), "Invalid -max-duration: %s\n", *maxDuration)
+		flag.Usage()
+		return 2
+	}
+	if watchInterval < 0 {
+		fmt.Fprintf(flag.CommandLine.Output(), "Invalid -watch: %s\n", watchInterval)
+		flag.Usage()
+		return 2
+	}
+
+	if namespace == "" {
+		if namespace, err = defaultNamespace(roots); err != nil {
+			errorf("Error resolving root directory: %s\n", err)
+			return 1
+		}
+	}
+
+	// 排除模式的来源和优先级：
+	//   1. 指定了 -exclude-file 时只读取这一个文件，它的位置与根目录无关，相对路径相对于当前目录；
+	//      这个文件是明确要求的，读不到时报错退出，而不是在没有排除规则的情况下扫描
+	//   2. 否则读取每个本地根目录下的 exclude_patterns.txt（如果有），其中的模式对所有根目录都生效；
+	//      这些文件是可选的，不存在时只给出警告
+	// -exclude 给出的模式总是追加在文件中的模式后面。这里只确定要读哪些文件，-print-config 之后才读取
+	var excludeFiles []string
+	if *excludeFile != "" {
+		excludeFiles = []string{*excludeFile}
+	} else {
+		for _, rootDir := range roots {
+			if !scanner.IsRemote(rootDir) {
+				excludeFiles = append(excludeFiles, filepath.Join(rootDir, "exclude_patterns.txt"))
 			}
+		}
+	}
 
-			fileInfo, err := os.Lstat(osPathname)
+	// 遍历和过滤由 scanner 包完成，这里只负责把找到的文件写入存储
+	scanOpts := scanner.Options{
+		Roots:           roots,
+		MinSize:         minSizeBytes,
+		MaxSize:         outputOpts.maxSize,
+		ExtMinSize:      extMinSizes,
+		Exclude:         []string(excludeFlags),
+		Include:         []string(includeFlags),
+		ExcludeExts:     strings.Split(*excludeExt, ","),
+		SkipHidden:      *skipHidden,
+		MaxDepth:        *maxDepth,
+		FollowSymlinks:  *followSymlinks,
+		DedupeHardlinks: *dedupeHardlinks,
+		IgnoreFile:      *ignoreFile,
+		ExcludePaths:    outputExcludes(roots, selfOutputFiles(*progressFile, *pathListFlag)),
+	}
+	scanOpts.ExcludeIgnoreCase = *excludeIgnoreCase
+	scanOpts.CaptureOwner = captureOwner
+	scanOpts.AllocatedSize = *sizeMode == "allocated"
+	scanOpts.ScanArchives = *scanArchives
+	for _, t := range strings.Split(*skipFSTypes, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			scanOpts.SkipFSTypes = append(scanOpts.SkipFSTypes, t)
+		}
+	}
+	if len(scanOpts.SkipFSTypes) > 0 && runtime.GOOS != "linux" {
+		diagf("Warning: -skip-fstypes only works on Linux, scanning all filesystems\n")
+	}
+
+	// 工作数不合法时退回默认值，避免没有 worker 导致 taskQueue 死锁
+	workerCount := *workersFlag
+	if workerCount <= 0 {
+		workerCount = runtime.NumCPU()
+	}
+
+	// -print-config 只打印设置，不创建输出目录、不启动 metrics 服务，也不读取模式文件
+	if *printConfigFlag {
+		var includeFiles []string
+		if *includeFile != "" {
+			includeFiles = []string{*includeFile}
+		}
+		printConfig(os.Stdout, scanOpts, outputOpts, workerCount, excludeFiles, includeFiles)
+		return 0
+	}
+
+	if err := createOutDir(); err != nil {
+		errorf("Error creating output directory: %s\n", err)
+		return 1
+	}
+	if metricsAddr != "" {
+		if err := startMetrics(metricsAddr); err != nil {
+			errorf("Error starting metrics server: %s\n", err)
+			return 1
+		}
+	}
+
+	// 第一次收到 SIGINT/SIGTERM 只停止遍历，已经写入 Redis 的数据仍然会保存到日志；
+	// 再次收到信号则取消根 context，让保存过程中的 Redis 调用也尽快返回。
+	// -max-duration 到期与第一次收到信号的效果相同
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	scanCtx, cancelScan := context.WithCancel(ctx)
+	if *maxDuration > 0 {
+		scanCtx, cancelScan = context.WithTimeout(ctx, *maxDuration)
+	}
+	defer cancelScan()
+	stopScan = cancelScan
+	// runScan 返回时 cancel 会让这个 goroutine 退出，并停止接收信号
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigCh)
+	go func() {
+		select {
+		case sig := <-sigCh:
+			infof("Received %s, stopping scan and saving partial results (send again to abort)\n", sig)
+			atomic.StoreInt32(&watchStopped, 1)
+			cancelScan()
+		case <-ctx.Done():
+			return
+		}
+		select {
+		case <-sigCh:
+			infof("Aborting\n")
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	var excludePatterns []string
+	if *excludeFile != "" {
+		patterns, err := loadExcludePatterns(*excludeFile)
+		if err != nil {
+			errorf("Error reading exclude patterns: %s\n", err)
+			return 1
+		}
+		excludePatterns = patterns
+	} else {
+		for _, name := range excludeFiles {
+			patterns, err := loadExcludePatterns(name)
 			if err != nil {
-				fmt.Printf("Error getting file info: %s\n", err)
-				return err
+				diagf("Warning: Could not read exclude patterns: %s\n", err)
 			}
+			excludePatterns = append(excludePatterns, patterns...)
+		}
+	}
+	scanOpts.Exclude = append(excludePatterns, excludeFlags...)
 
-			// 检查文件大小是否满足最小阈值
-			if fileInfo.Size() < minSizeBytes {
-				return nil
+	// 指定了包含模式时，只记录至少匹配其中一个模式的文件，排除模式优先
+	if *includeFile != "" {
+		patterns, err := loadExcludePatterns(*includeFile)
+		if err != nil {
+			errorf("Error reading include patterns: %s\n", err)
+			return 1
+		}
+		scanOpts.Include = append(patterns, includeFlags...)
+	}
+
+	var store Store
+	if !dryRun && !*benchmark {
+		if store, err = openStore(ctx); err != nil {
+			errorf("Error opening store: %s\n", err)
+			return 1
+		}
+		defer store.Close()
+	}
+
+	if *benchmark {
+		results, err := benchmarkWorkers(scanCtx, scanOpts, benchmarkCounts)
+		for _, r := range results {
+			infof("%s\n", r)
+		}
+		if err != nil {
+			errorf("Benchmark failed: %s\n", err)
+			return 1
+		}
+		if best := fastest(results); best != nil {
+			infof("Fastest: -workers %d\n", best.Workers)
+		}
+		return reportErrors(false)
+	}
+
+	var totalEntries int64
+	var hardlinksSkipped int64
+	var errorsSkipped int64
+	if *precount && currentLevel >= levelInfo {
+		for _, rootDir := range roots {
+			if scanner.IsRemote(rootDir) {
+				continue
+			}
+			count, err := countEntries(rootDir)
+			if err != nil {
+				diagf("Warning: Could not count entries for progress: %s\n", err)
 			}
+			totalEntries += count
+		}
+	}
 
-			// 将任务发送到工作池
-			taskQueue <- func() {
-				if fileInfo.Mode().IsDir() {
-					processDirectory(osPathname)
-				} else if fileInfo.Mode().IsRegular() {
-					processFile(osPathname, fileInfo.Mode())
-				} else if fileInfo.Mode()&os.ModeSymlink != 0 {
-					processSymlink(osPathname)
-				} else {
-					fmt.Printf("Skipping unknown type: %s\n", osPathname)
+	// Start a goroutine to periodically print progress
+	// 指定了 -progress-file 时改为每秒覆盖写入该文件。遍历结束后由 stopProgress 停止，
+	// 中途出错返回时 defer 也会停止它，不会在 runScan 返回之后继续打印
+	startTime := time.Now()
+	progressDone := make(chan struct{})
+	progressStopped := make(chan struct{})
+	var progressOnce sync.Once
+	stopProgress := func() {
+		progressOnce.Do(func() {
+			close(progressDone)
+			<-progressStopped
+		})
+	}
+	defer stopProgress()
+	if *progressFile != "" || currentLevel >= levelInfo {
+		go func() {
+			defer close(progressStopped)
+			ticker := time.NewTicker(time.Second)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-progressDone:
+					return
+				case <-ticker.C:
+				}
+				if *progressFile == "" && jsonLogFlag {
+					diagEvent(levelInfo, "progress", progressFields(time.Since(startTime), totalEntries))
+					continue
+				}
+				line := progressLine(time.Since(startTime), totalEntries)
+				if *progressFile == "" {
+					diagf("%s\n", line)
+					continue
+				}
+				if err := writeStatusFile(*progressFile, statusLine(line, time.Since(startTime))); err != nil {
+					scanErrors.add("progress", *progressFile, err)
+					return
 				}
 			}
+		}()
+	} else {
+		close(progressStopped)
+	}
 
-			return nil
-		},
-		Unsorted: true,
+	diagf("Using %d workers\n", workerCount)
+	diagEvent(levelInfo, "scan_start", map[string]interface{}{
+		"roots": roots, "min_size": minSizeBytes, "workers": workerCount, "dry_run": dryRun,
 	})
+	// -find-dupes 和 -verify 共用一条哈希流水线，读文件和计算哈希的并发数分别设置；
+	// -detect-type 读取文件开头时也使用其中的 IO 工作池
+	var hasher *hashPipeline
+	if (*findDupes || *verify || *detectType) && !dryRun {
+		ioWorkers, hashWorkers := *ioWorkersFlag, *hashWorkersFlag
+		if ioWorkers <= 0 {
+			ioWorkers = workerCount
+		}
+		if hashWorkers <= 0 {
+			hashWorkers = runtime.NumCPU()
+		}
+		hasher = newHashPipeline(ioWorkers, hashWorkers)
+		defer hasher.close()
+		verbosef("Hashing with %d IO workers and %d hash workers\n", ioWorkers, hashWorkers)
+	}
+	if *findDupes && !dryRun {
+		dupes = newDupeFinder()
+	}
+	if *verify && !dryRun {
+		verifier = newChecksumVerifier(hasher)
+	}
+	if *detectType && !dryRun {
+		typeDetector = hasher
+	}
 
-	// 关闭任务队列，并等待所有任务完成
+	var dirSizes *dirTotals
+	if *dirTotalsFlag && !dryRun {
+		dirSizes = newDirTotals()
+	}
+	var fileCounts *dirCounts
+	if *minFileCount > 0 && !dryRun {
+		fileCounts = newDirCounts()
+	}
+	var extSizes *extTotals
+	if *byExt && !dryRun {
+		extSizes = newExtTotals()
+	}
+
+	scanOpts.Workers = workerCount
+	scanOpts.Visit = func(root, path string, info os.FileInfo) {
+		// 目录和扩展名的汇总与记录的文件使用同一种大小
+		size := info.Size()
+		if scanOpts.AllocatedSize {
+			size = scanner.AllocatedSize(info)
+		}
+		if dirSizes != nil && info.Mode().IsRegular() && size >= dirMinSizeBytes {
+			dirSizes.add(root, path, size)
+		}
+		if fileCounts != nil && info.Mode().IsRegular() {
+			fileCounts.add(path)
+		}
+		if extSizes != nil && info.Mode().IsRegular() && size >= extMinSizeBytes {
+			extSizes.add(path, size)
+		}
+	}
+	var slowest *slowStats
+	if *profileStats > 0 {
+		slowest = newSlowStats(*profileStats)
+		scanOpts.OnStat = slowest.add
+	}
+	// 被中断的扫描把完整遍历过的目录写入检查点，-resume 时跳过这些目录；
+	// 没有检查点（例如进程崩溃）时仍然靠未变化文件的跳过逻辑避免重复写入
+	var scanCheckpoint *checkpoint
+	if !dryRun {
+		scanCheckpoint = newCheckpoint()
+		if *resume {
+			if scanCheckpoint, err = loadCheckpoint("fav.log.checkpoint"); err != nil {
+				errorf("Error reading checkpoint: %s\n", err)
+				return 1
+			}
+			infof("Resuming: skipping %d completed directories\n", len(scanCheckpoint.done))
+			scanOpts.SkipDir = scanCheckpoint.skip
+		}
+		scanOpts.DirDone = scanCheckpoint.markDone
+	}
+	scanOpts.OnError = recordScanError
+	scanOpts.Logf = verbosef
+	scanOpts.Scanned = &scannedCounter
+	scanOpts.HardlinksSkipped = &hardlinksSkipped
+	scanOpts.ErrorsSkipped = &errorsSkipped
+	// 路径列表要在开始遍历之前创建：之后再出错返回时，遍历的 goroutine 会一直阻塞在没人读取的 files 上
+	if *pathListFlag != "" {
+		if pathList, err = newPathListWriter(*pathListFlag); err != nil {
+			errorf("Error creating path list: %s\n", err)
+			return 1
+		}
+	}
+	files, err := scanner.Scan(scanCtx, scanOpts)
+	if err != nil {
+		if pathList != nil {
+			pathList.discard()
+			pathList = nil
+		}
+		errorf("Invalid pattern: %s\n", err)
+		return 1
+	}
+
+	stopStream := func() {}
+	if *stream {
+		stopStream = startResultStream(os.Stdout, baseDir, outputOpts.absPaths)
+	}
+	taskQueue, poolWg := scanner.NewWorkerPool(workerCount)
+	for f := range files {
+		f := f
+		taskQueue <- func() {
+			// 取消只停止遍历，已经找到的文件仍然写入存储，检查点中的目录才是完整的
+			processFile(ctx, store, f)
+		}
+	}
+
+	// 关闭任务队列，并等待所有已投递的任务完成
 	close(taskQueue)
 	poolWg.Wait()
-	fmt.Printf("Final progress: %d files processed.\n", atomic.LoadInt32(&progressCounter))
+	stopStream()
+	// 写入缓冲中剩下的记录，saveLogs 读取存储时才能看到全部文件
+	if store != nil {
+		if err := store.Flush(ctx); err != nil && ctx.Err() == nil {
+			scanErrors.add("store", "flush", err)
+		}
+	}
+	interrupted := scanCtx.Err() != nil
+	timedOut := errors.Is(scanCtx.Err(), context.DeadlineExceeded)
+	stopProgress()
+	finalLine := strings.TrimPrefix(progressLine(time.Since(startTime), 0), "Progress: ")
+	if jsonLogFlag {
+		fields := progressFields(time.Since(startTime), 0)
+		fields["interrupted"] = interrupted
+		fields["timed_out"] = timedOut
+		fields["hardlinks_skipped"] = atomic.LoadInt64(&hardlinksSkipped)
+		fields["unreadable_skipped"] = atomic.LoadInt64(&errorsSkipped)
+		fields["store_unavailable"] = atomic.LoadInt64(&storeUnavailableCounter)
+		diagEvent(levelInfo, "scan_done", fields)
+	} else {
+		diagf("Final: %s\n", finalLine)
+	}
+	if *dedupeHardlinks {
+		infof("Collapsed %d hard link duplicates.\n", atomic.LoadInt64(&hardlinksSkipped))
+	}
+	if n := atomic.LoadInt64(&errorsSkipped); n > 0 {
+		infof("Skipped %d entries that could not be read.\n", n)
+	}
+	if n := atomic.LoadInt64(&storeUnavailableCounter); n > 0 {
+		diagf("%d files were found after the store became unavailable.\n", n)
+	}
+	if slowest != nil {
+		infof("Slowest lstat calls:\n")
+		for _, t := range slowest.sorted() {
+			infof("  %s %s\n", t.Elapsed.Round(time.Microsecond), t.Path)
+		}
+	}
+	if *progressFile != "" {
+		if err := writeStatusFile(*progressFile, statusLine("Done: "+finalLine, time.Since(startTime))); err != nil {
+			scanErrors.add("progress", *progressFile, err)
+		}
+	}
+
+	if pathList != nil {
+		n, err := pathList.close()
+		pathList = nil
+		if err != nil {
+			scanErrors.addFatal("save", *pathListFlag, err)
+		} else if *pathListFlag != "-" {
+			infof("Saved %d paths to %s\n", n, *pathListFlag)
+		}
+		if !*countOnly {
+			return checkBudget(reportErrors(false), budget)
+		}
+	}
+	if *countOnly {
+		// 统计结果就是 -count-only 的输出，即使指定了 -quiet 也打印
+		files, bytes := atomic.LoadInt32(&progressCounter), atomic.LoadInt64(&bytesCounter)
+		sizeRange := "at least " + formatBytes(minSizeBytes)
+		if outputOpts.maxSize > 0 {
+			sizeRange += " and at most " + formatBytes(outputOpts.maxSize)
+		}
+		fmt.Printf("%d files of %s, %s (%d bytes) in total.\n", files, sizeRange, formatBytes(bytes), bytes)
+		return checkBudget(reportErrors(false), budget)
+	}
+	if dryRun {
+		infof("Dry run: %d files would be processed, %d bytes in total.\n",
+			atomic.LoadInt32(&progressCounter), atomic.LoadInt64(&bytesCounter))
+		return checkBudget(reportErrors(false), budget)
+	}
+
+	// -watch 时删除已经不存在的文件的记录，每一轮的日志只包含当前还在的文件
+	if watchInterval > 0 && !interrupted {
+		checked, removed := removeStaleEntries(ctx, store)
+		verbosef("Checked %d entries, removed %d stale entries.\n", checked, removed)
+	}
 
 	// 文件处理完成后的保存操作
-	if err := saveToFile(rootDir, "fav.log", false); err != nil {
-		fmt.Printf("Error saving to fav.log: %s\n", err)
-	} else {
-		fmt.Printf("Saved data to %s\n", filepath.Join(rootDir, "fav.log"))
+	saveLogs(ctx, store, baseDir, outputOpts)
+
+	switch {
+	case !interrupted:
+		if err := os.Remove(outputPath("fav.log.checkpoint")); err != nil && !os.IsNotExist(err) {
+			scanErrors.add("checkpoint", outputPath("fav.log.checkpoint"), err)
+		}
+	case ctx.Err() != nil || scanErrors.hasCategory("store"):
+		// 有文件没能写入存储时，已完成的目录并不完整，不写检查点
+		infof("Not writing a checkpoint because some files were not stored\n")
+	default:
+		if err := scanCheckpoint.saveToFile("fav.log.checkpoint"); err != nil {
+			scanErrors.add("checkpoint", outputPath("fav.log.checkpoint"), err)
+		} else {
+			infof("Saved checkpoint to %s, run again with -resume to continue\n", outputPath("fav.log.checkpoint"))
+		}
 	}
 
-	if err := saveToFile(rootDir, "fav.log.sort", true); err != nil {
-		fmt.Printf("Error saving to fav.log.sort: %s\n", err)
-	} else {
-		fmt.Printf("Saved sorted data to %s\n", filepath.Join(rootDir, "fav.log.sort"))
+	if *writeMeta {
+		metaRoots, err := absRoots(roots)
+		if err != nil {
+			metaRoots = roots
+		}
+		var exts []string
+		for _, ext := range scanOpts.ExcludeExts {
+			if ext = strings.TrimSpace(ext); ext != "" {
+				exts = append(exts, ext)
+			}
+		}
+		meta := scanMeta{
+			Version:     toolVersion(),
+			Roots:       metaRoots,
+			StartedAt:   startTime.UTC().Format(time.RFC3339),
+			FinishedAt:  time.Now().UTC().Format(time.RFC3339),
+			MinSize:     minSizeBytes,
+			MaxSize:     outputOpts.maxSize,
+			SizeMode:    *sizeMode,
+			ExtMinSizes: extMinSizes,
+			Exclude:     scanOpts.Exclude,
+			Include:     scanOpts.Include,
+			ExcludeExts: exts,
+			Store:       storeType,
+			Namespace:   namespace,
+			HashAlgo:    hashAlgo,
+			Files:       int64(atomic.LoadInt32(&progressCounter)),
+			Bytes:       atomic.LoadInt64(&bytesCounter),
+			Interrupted: interrupted,
+			TimedOut:    timedOut,
+		}
+		if err := saveMeta("fav.log.meta", meta); err != nil {
+			scanErrors.addFatal("save", "fav.log.meta", err)
+		} else {
+			infof("Saved scan metadata to %s\n", outputPath("fav.log.meta"))
+		}
+	}
+
+	var dupeGroups []dupeGroup
+	if dupes != nil && ctx.Err() == nil {
+		groups := dupes.findDuplicates(hasher, workerCount, *dupeMinCopies, dupeMinWasteBytes)
+		if err := saveDupesToFile(baseDir, "fav.log.dupes", groups, outputOpts.absPaths); err != nil {
+			scanErrors.addFatal("save", "fav.log.dupes", err)
+		} else {
+			infof("Saved %d duplicate groups to %s\n", len(groups), outputPath("fav.log.dupes"))
+		}
+		dupeGroups = groups
+	}
+
+	if verifier != nil && !interrupted {
+		mismatches := verifier.sorted()
+		if err := saveMismatchesToFile(baseDir, "fav.log.verify", mismatches, outputOpts.absPaths); err != nil {
+			scanErrors.addFatal("save", "fav.log.verify", err)
+		} else {
+			infof("Verified %d files, %d checksum mismatches saved to %s\n",
+				atomic.LoadInt64(&verifier.checked), len(mismatches), outputPath("fav.log.verify"))
+		}
+	}
+
+	if dirSizes != nil {
+		if err := saveDirTotals(baseDir, "fav.log.dirs", dirSizes, outputOpts.top, outputOpts.absPaths); err != nil {
+			scanErrors.addFatal("save", "fav.log.dirs", err)
+		} else {
+			infof("Saved directory totals to %s\n", outputPath("fav.log.dirs"))
+		}
+	}
+
+	if fileCounts != nil {
+		if n, err := saveDirCounts(baseDir, "fav.log.counts", fileCounts, *minFileCount, outputOpts.top, outputOpts.absPaths); err != nil {
+			scanErrors.addFatal("save", "fav.log.counts", err)
+		} else {
+			infof("Saved %d directories with at least %d files to %s\n", n, *minFileCount, outputPath("fav.log.counts"))
+		}
+	}
+
+	if extSizes != nil {
+		if err := saveExtTotals("fav.log.ext", extSizes, outputOpts.top); err != nil {
+			scanErrors.addFatal("save", "fav.log.ext", err)
+		} else {
+			infof("Saved extension totals to %s\n", outputPath("fav.log.ext"))
+		}
+	}
+
+	if *jsonReport {
+		reportRoots, err := absRoots(roots)
+		if err != nil {
+			reportRoots = roots
+		}
+		report := scanReport{
+			Version:    toolVersion(),
+			Roots:      reportRoots,
+			StartedAt:  startTime.UTC().Format(time.RFC3339),
+			FinishedAt: time.Now().UTC().Format(time.RFC3339),
+			Summary: reportSummary{
+				Files:          int64(atomic.LoadInt32(&progressCounter)),
+				Bytes:          atomic.LoadInt64(&bytesCounter),
+				Unchanged:      atomic.LoadInt64(&unchangedCounter),
+				Errors:         scanErrors.count(),
+				ElapsedSeconds: time.Since(startTime).Seconds(),
+				Interrupted:    interrupted,
+				TimedOut:       timedOut,
+			},
+		}
+		top := outputOpts.top
+		if top <= 0 {
+			top = summaryTop
+		}
+		if largest, err := largestFiles(ctx, store, top, outputOpts); err != nil {
+			scanErrors.add("report", "largest", err)
+		} else {
+			report.Largest = newReportFiles(largest, baseDir, outputOpts.absPaths)
+		}
+		if extSizes != nil {
+			report.Extensions = newReportExts(extSizes, extMinSizeBytes, outputOpts.top)
+		}
+		if dupes != nil && ctx.Err() == nil {
+			report.Duplicates = newReportDupes(dupeGroups, baseDir, outputOpts.absPaths)
+		}
+		if err := saveRunReport(runReportName, report); err != nil {
+			scanErrors.addFatal("save", runReportName, err)
+		} else {
+			infof("Saved run report to %s\n", outputPath(runReportName))
+		}
+	}
+
+	if human, color := humanOutput(logOutput); human && !jsonLogFlag && currentLevel >= levelInfo {
+		sum := scanSummary{
+			Files:     int64(atomic.LoadInt32(&progressCounter)),
+			Bytes:     atomic.LoadInt64(&bytesCounter),
+			Unchanged: atomic.LoadInt64(&unchangedCounter),
+			Errors:    scanErrors.count(),
+			Elapsed:   time.Since(startTime),
+			Dupes:     mostWasted(dupeGroups, summaryTop),
+		}
+		if largest, err := largestFiles(ctx, store, summaryTop, outputOpts); err == nil {
+			sum.Largest = largest
+		}
+		printSummary(logOutput, color, sum, baseDir, outputOpts.absPaths)
+	}
+
+	if timedOut {
+		infof("Scan stopped after -max-duration %s, saved results are partial.\n", *maxDuration)
+	} else if atomic.LoadInt32(&limitReached) == 1 {
+		infof("Scan stopped after -limit %d files, saved results are partial.\n", fileLimit)
+	} else if interrupted {
+		infof("Scan was interrupted, saved results are partial.\n")
+	}
+	return checkBudget(reportErrors(true), budget)
+}
+
+// exitOverBudget 是匹配文件的总大小超过 -fail-if-over 时的退出码，
+// 与出错时的 1 和参数错误时的 2 区分开，脚本可以据此判断目录是否长得太大
+const exitOverBudget = 3
+
+// checkBudget 在没有其他错误（code 为 0）时检查 -fail-if-over：本次扫描匹配的文件总大小超过 budget 时返回 exitOverBudget。
+// budget 为负数表示不检查。扫描被中断时总大小只是已扫描部分，已经超出时仍然返回 exitOverBudget
+func checkBudget(code int, budget int64) int {
+	if code != 0 || budget < 0 {
+		return code
+	}
+	if total := atomic.LoadInt64(&bytesCounter); total > budget {
+		errorf("Matched files total %s (%d bytes), over the -fail-if-over budget of %s\n", formatBytes(total), total, formatBytes(budget))
+		return exitOverBudget
 	}
+	return 0
 }
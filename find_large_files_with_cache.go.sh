@@ -12,5 +12,5 @@ go get -u github.com/karrick/godirwalk
 #docker-compose down -v && docker-compose up -d
 docker-compose restart
 
-go build find_large_files_with_cache.go && \
+go build -o find_large_files_with_cache . && \
     sudo ./find_large_files_with_cache /media
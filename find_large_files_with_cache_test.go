@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestCSVQuote(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"plain.mkv", `"plain.mkv"`},
+		{`foo"bar.mkv`, `"foo""bar.mkv"`},
+		{`""`, `""""""`},
+		{"a,b", `"a,b"`},
+		{"", `""`},
+	}
+	for _, tt := range tests {
+		if got := csvQuote(tt.in); got != tt.want {
+			t.Errorf("csvQuote(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+// TestWriteCSVQuotedPath 写出文件名带双引号的日志，再用 encoding/csv 读回来
+func TestWriteCSVQuotedPath(t *testing.T) {
+	withOutDir(t)
+	path := `/scan/foo"bar.mkv`
+	data := map[string]FileInfo{path: {Size: 1234}}
+	if err := saveToFile("/scan", "fav.log", "csv", []string{path}, data, sortSize, saveOptions{absPaths: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := os.Open(outputPath("fav.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	records, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		t.Fatalf("fav.log is not valid CSV: %v", err)
+	}
+	if len(records) != 1 || len(records[0]) != 2 {
+		t.Fatalf("got records %q, want one record with two fields", records)
+	}
+	if records[0][0] != "1234" || records[0][1] != path {
+		t.Errorf("got %q, want [\"1234\" %q]", records[0], path)
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int64
+	}{
+		{"0", 0},
+		{"1048576", 1048576},
+		{"1K", 1 << 10},
+		{"500M", 500 << 20},
+		{"200M", 200 * 1024 * 1024},
+		// 4 GiB 超出 32 位 int 的范围，必须按 int64 计算
+		{"4G", 4 * 1024 * 1024 * 1024},
+		{"4096M", 4294967296},
+		{"2T", 2 << 40},
+		{"4GB", 4 << 30},
+		{"4g", 4 << 30},
+		{" 10kb ", 10 << 10},
+		{"8191T", 8191 << 40},
+	}
+	for _, tt := range tests {
+		got, err := parseSize(tt.in)
+		if err != nil {
+			t.Errorf("parseSize(%q): %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseSize(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+	for _, in := range []string{"", "B", "M", "-1M", "1.5G", "12X", "10MM", "9999999T"} {
+		if got, err := parseSize(in); err == nil {
+			t.Errorf("parseSize(%q) = %d, want an error", in, got)
+		}
+	}
+}
+
+// TestCollectEntriesSizeRange 检查日志对缓存中的记录同时应用下限和上限，两端都包含在内
+func TestCollectEntriesSizeRange(t *testing.T) {
+	store := newMemoryStore()
+	ctx := context.Background()
+	for _, size := range []int64{10, 100, 500, 1000, 5000} {
+		if err := store.Put(ctx, fmt.Sprintf("/scan/%d.bin", size), FileInfo{Size: size}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		minSize, maxSize int64
+		want             string
+	}{
+		{0, 0, "5000 1000 500 100 10"},
+		{100, 0, "5000 1000 500 100"},
+		{0, 500, "500 100 10"},
+		{100, 1000, "1000 500 100"},
+	}
+	for _, tt := range tests {
+		opts := saveOptions{minSize: tt.minSize, maxSize: tt.maxSize}
+		_, sorted, err := collectEntries(ctx, store, []sortKey{sortSize}, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, p := range sorted[sortSize] {
+			got = append(got, strings.TrimSuffix(strings.TrimPrefix(p, "/scan/"), ".bin"))
+		}
+		if strings.Join(got, " ") != tt.want {
+			t.Errorf("min %d, max %d: got %q, want %s", tt.minSize, tt.maxSize, got, tt.want)
+		}
+		largest, err := largestFiles(ctx, store, 10, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(largest) != len(got) {
+			t.Errorf("min %d, max %d: largestFiles returned %d files, want %d like the log", tt.minSize, tt.maxSize, len(largest), len(got))
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/huangyingw/FileSorter/scanner"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// runGC 实现 gc 子命令：遍历存储中的记录，删除已经不存在的文件对应的记录
+func runGC(args []string) {
+	fs := flag.NewFlagSet("gc", flag.ExitOnError)
+	addStoreFlags(fs)
+	addLogFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: ./find_large_files_with_cache gc [options] <directory>...")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() < 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	if err := applyLogFlags(); err != nil {
+		fmt.Fprintln(fs.Output(), err)
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	// 目录参数只用来确定存储的命名空间
+	roots := fs.Args()
+	var err error
+	if len(roots) > 1 {
+		if roots, err = absRoots(roots); err != nil {
+			errorf("Error resolving directory: %s\n", err)
+			os.Exit(1)
+		}
+	}
+	if namespace == "" {
+		if namespace, err = defaultNamespace(roots); err != nil {
+			errorf("Error resolving directory: %s\n", err)
+			os.Exit(1)
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	store, err := openStore(ctx)
+	if err != nil {
+		errorf("Error opening store: %s\n", err)
+		os.Exit(1)
+	}
+	defer store.Close()
+
+	checked, removed := removeStaleEntries(ctx, store)
+	infof("Checked %d entries, removed %d stale entries.\n", checked, removed)
+	if code := reportErrors(false); code != 0 {
+		store.Close()
+		os.Exit(code)
+	}
+}
+
+// removeStaleEntries 删除存储中已经不存在的本地文件的记录，返回检查和删除的记录数；出错时记录到 scanErrors
+func removeStaleEntries(ctx context.Context, store Store) (checked, removed int) {
+	// 先收集再删除：SQLite 的 Iterate 占用唯一的连接，回调中不能写入
+	var missing []string
+	err := store.Iterate(ctx, func(path string, _ FileInfo) error {
+		// 远程文件无法在本地检查是否还存在，保留它们的记录
+		if scanner.IsRemote(path) {
+			return nil
+		}
+		checked++
+		// 压缩包中的文件在本地并不存在，只在压缩包本身被删除时删除它们的记录
+		target := path
+		if archive, _, ok := scanner.SplitArchivePath(path); ok {
+			target = archive
+		}
+		if _, err := os.Lstat(target); os.IsNotExist(err) {
+			missing = append(missing, path)
+		}
+		return nil
+	})
+	if err != nil {
+		scanErrors.addFatal("store", "", err)
+	}
+
+	for _, path := range missing {
+		if ctx.Err() != nil {
+			break
+		}
+		if err := store.Delete(ctx, path); err != nil {
+			scanErrors.add("store", path, err)
+			continue
+		}
+		verbosef("Removed stale entry: %s\n", path)
+		removed++
+	}
+	return checked, removed
+}
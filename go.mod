@@ -3,10 +3,21 @@ module github.com/huangyingw/FileSorter
 go 1.18
 
 require (
+	github.com/alicebob/miniredis/v2 v2.23.0
+	github.com/cespare/xxhash/v2 v2.2.0
+	github.com/go-redis/redis/v8 v8.11.5
+	github.com/karrick/godirwalk v1.17.0
+	github.com/mattn/go-sqlite3 v1.14.17
+	github.com/pkg/sftp v1.13.5
+	golang.org/x/crypto v0.0.0-20211215153901-e495a2d5b3d3
+)
+
+require (
+	github.com/alicebob/gopher-json v0.0.0-20200520072559-a9ecdc9d1d3a // indirect
 	github.com/allegro/bigcache v1.2.1 // indirect
-	github.com/cespare/xxhash/v2 v2.2.0 // indirect
 	github.com/dgryski/go-rendezvous v0.0.0-20200823014737-9f7001d12a5f // indirect
-	github.com/go-redis/redis/v8 v8.11.5 // indirect
-	github.com/karrick/godirwalk v1.17.0 // indirect
+	github.com/kr/fs v0.1.0 // indirect
 	github.com/mattn/go-zglob v0.0.4 // indirect
+	github.com/yuin/gopher-lua v0.0.0-20210529063254-f4c35e4016d9 // indirect
+	golang.org/x/sys v0.0.0-20211216021012-1d35b9e2eb4e // indirect
 )
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"fmt"
+	"github.com/cespare/xxhash/v2"
+	"golang.org/x/crypto/blake2b"
+	"hash"
+	"sort"
+	"strings"
+)
+
+// defaultHashAlgo 是旧版本唯一使用的算法，使用它时缓存 key 和校验和的格式与旧版本相同
+const defaultHashAlgo = "sha256"
+
+// hashAlgos 是 -hash-algo 支持的算法。xxhash 不是加密哈希，但比其余几种快得多，适合只用来分组查重
+var hashAlgos = map[string]func() hash.Hash{
+	"sha256": sha256.New,
+	"sha1":   sha1.New,
+	"blake2b": func() hash.Hash {
+		h, _ := blake2b.New256(nil) // 没有 key 时不会返回错误
+		return h
+	},
+	"xxhash": func() hash.Hash { return xxhash.New() },
+}
+
+// hashAlgo 是 -hash-algo 选择的算法，路径哈希（Redis 的 key）和文件内容哈希都使用它
+var hashAlgo = defaultHashAlgo
+
+// hashAlgoFlag 是 -hash-algo 的 flag.Value，解析参数时就拒绝不支持的算法
+type hashAlgoFlag struct{}
+
+func (hashAlgoFlag) String() string { return hashAlgo }
+
+func (hashAlgoFlag) Set(s string) error {
+	if _, ok := hashAlgos[s]; !ok {
+		return fmt.Errorf("unknown hash algorithm %q (want %s)", s, strings.Join(hashAlgoNames(), ", "))
+	}
+	hashAlgo = s
+	return nil
+}
+
+// hashAlgoNames 返回排好序的算法名
+func hashAlgoNames() []string {
+	names := make([]string, 0, len(hashAlgos))
+	for name := range hashAlgos {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// newHasher 返回 -hash-algo 选择的算法的一个新实例
+func newHasher() hash.Hash {
+	return hashAlgos[hashAlgo]()
+}
+
+// tagChecksum 给非默认算法计算的校验和加上 "算法:" 前缀，默认算法的校验和保持旧格式
+func tagChecksum(sum string) string {
+	if hashAlgo == defaultHashAlgo {
+		return sum
+	}
+	return hashAlgo + ":" + sum
+}
+
+// checksumAlgo 返回校验和使用的算法，没有前缀的是旧格式的 SHA-256
+func checksumAlgo(checksum string) string {
+	if i := strings.IndexByte(checksum, ':'); i >= 0 {
+		return checksum[:i]
+	}
+	return defaultHashAlgo
+}
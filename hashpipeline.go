@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/hex"
+	"github.com/huangyingw/FileSorter/scanner"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+)
+
+// hashBufferSize 是计算哈希时每次读取的字节数
+const hashBufferSize = 64 * 1024
+
+// hashReadAhead 是每个文件在 IO 阶段最多提前读好、等待计算哈希的块数
+const hashReadAhead = 4
+
+// hashBuffers 在读取文件的 worker 之间复用读缓冲区，避免每个文件、每个块都分配一次；
+// 同时使用的缓冲区数量受两级工作池的 worker 数和 hashReadAhead 限制
+var hashBuffers = sync.Pool{
+	New: func() interface{} {
+		buf := make([]byte, hashBufferSize)
+		return &buf
+	},
+}
+
+// hashChunk 是 IO 阶段读出的一块文件内容
+type hashChunk struct {
+	buf *[]byte
+	n   int
+}
+
+// hashPipeline 把计算文件内容的哈希拆成两级：IO worker 读取文件，hash worker 计算哈希，
+// 两级各自有受限的工作池，读取慢的磁盘和计算慢的 CPU 可以分别设置并发数
+type hashPipeline struct {
+	ioQueue   chan<- scanner.Task
+	ioWg      *sync.WaitGroup
+	hashQueue chan<- scanner.Task
+	hashWg    *sync.WaitGroup
+}
+
+func newHashPipeline(ioWorkers, hashWorkers int) *hashPipeline {
+	p := &hashPipeline{}
+	p.ioQueue, p.ioWg = scanner.NewWorkerPool(ioWorkers)
+	p.hashQueue, p.hashWg = scanner.NewWorkerPool(hashWorkers)
+	return p
+}
+
+// hash 以流的方式计算文件内容的哈希（算法由 -hash-algo 选择），不会把整个文件读入内存，可以被多个 goroutine 同时调用。
+// 文件的 IO 任务一定先于它的哈希任务开始执行，所以两级工作池都占满时也不会互相等待
+func (p *hashPipeline) hash(path string) (string, error) {
+	chunks := make(chan hashChunk, hashReadAhead)
+	readErr := make(chan error, 1)
+	sum := make(chan string, 1)
+
+	p.ioQueue <- func() {
+		readErr <- readChunks(path, chunks)
+	}
+	p.hashQueue <- func() {
+		hasher := newHasher()
+		for c := range chunks {
+			hasher.Write((*c.buf)[:c.n])
+			hashBuffers.Put(c.buf)
+		}
+		sum <- tagChecksum(hex.EncodeToString(hasher.Sum(nil)))
+	}
+
+	result := <-sum
+	if err := <-readErr; err != nil {
+		return "", err
+	}
+	return result, nil
+}
+
+// readChunks 把文件内容按块发送到 chunks，读完或出错后关闭 chunks
+func readChunks(path string, chunks chan<- hashChunk) error {
+	defer close(chunks)
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	for {
+		buf := hashBuffers.Get().(*[]byte)
+		n, err := io.ReadFull(file, *buf)
+		if n > 0 {
+			chunks <- hashChunk{buf: buf, n: n}
+		} else {
+			hashBuffers.Put(buf)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// unknownContentType 是无法读取或为空的文件的内容类型
+const unknownContentType = "unknown"
+
+// detectType 在 IO 工作池中读取文件开头的 512 字节，用 http.DetectContentType 判断内容类型；
+// 读取失败或文件为空时返回 unknownContentType，不会让这个文件记录失败
+func (p *hashPipeline) detectType(path string) string {
+	result := make(chan string, 1)
+	p.ioQueue <- func() {
+		result <- sniffContentType(path)
+	}
+	return <-result
+}
+
+func sniffContentType(path string) string {
+	file, err := os.Open(path)
+	if err != nil {
+		return unknownContentType
+	}
+	defer file.Close()
+	var head [512]byte
+	n, err := io.ReadFull(file, head[:])
+	if n == 0 || (err != nil && err != io.ErrUnexpectedEOF) {
+		return unknownContentType
+	}
+	return http.DetectContentType(head[:n])
+}
+
+// close 等待所有已提交的任务完成并停止两级工作池
+func (p *hashPipeline) close() {
+	close(p.ioQueue)
+	p.ioWg.Wait()
+	close(p.hashQueue)
+	p.hashWg.Wait()
+}
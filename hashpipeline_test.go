@@ -0,0 +1,140 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// writeHashFixture 在临时目录中写入 n 个大小为 size 的文件，内容各不相同
+func writeHashFixture(tb testing.TB, n, size int) []string {
+	tb.Helper()
+	dir := tb.TempDir()
+	paths := make([]string, n)
+	for i := range paths {
+		data := make([]byte, size)
+		for j := range data {
+			data[j] = byte(i + j)
+		}
+		paths[i] = filepath.Join(dir, fmt.Sprintf("%03d.bin", i))
+		if err := os.WriteFile(paths[i], data, 0644); err != nil {
+			tb.Fatal(err)
+		}
+	}
+	return paths
+}
+
+func TestHashPipeline(t *testing.T) {
+	// 空文件、不足一块、正好一块和跨多块的文件
+	sizes := []int{0, 100, hashBufferSize, hashBufferSize*3 + 7}
+	p := newHashPipeline(2, 2)
+	defer p.close()
+	for _, size := range sizes {
+		path := writeHashFixture(t, 1, size)[0]
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := sha256.Sum256(data)
+		got, err := p.hash(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != hex.EncodeToString(want[:]) {
+			t.Errorf("size %d: hash %s, want %x", size, got, want)
+		}
+	}
+	if _, err := p.hash(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("hash of a missing file succeeded")
+	}
+}
+
+// hashFiles 在 workers 个 goroutine 中计算 paths 中每个文件的哈希，read 把文件内容按块发送到 chunks，
+// release 在块计算完之后调用
+func hashFiles(b *testing.B, paths []string, workers int, read func(string, chan<- hashChunk) error, release func(*[]byte)) {
+	jobs := make(chan string)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for path := range jobs {
+				chunks := make(chan hashChunk, hashReadAhead)
+				readErr := make(chan error, 1)
+				go func() { readErr <- read(path, chunks) }()
+				hasher := newHasher()
+				for c := range chunks {
+					hasher.Write((*c.buf)[:c.n])
+					release(c.buf)
+				}
+				hasher.Sum(nil)
+				if err := <-readErr; err != nil {
+					b.Error(err)
+				}
+			}
+		}()
+	}
+	for _, path := range paths {
+		jobs <- path
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+// readChunksUnpooled 与 readChunks 相同，但每一块都新分配缓冲区，用作对照
+func readChunksUnpooled(path string, chunks chan<- hashChunk) error {
+	defer close(chunks)
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	for {
+		buf := make([]byte, hashBufferSize)
+		n, err := io.ReadFull(file, buf)
+		if n > 0 {
+			chunks <- hashChunk{buf: &buf, n: n}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// BenchmarkHashBuffers 比较 hashBuffers 复用缓冲区和每块新分配缓冲区时的速度与分配量：
+// 64 个 1 MiB 的文件，8 个 worker 同时计算
+func BenchmarkHashBuffers(b *testing.B) {
+	paths := writeHashFixture(b, 64, 1<<20)
+	var total int64
+	for _, p := range paths {
+		fi, err := os.Stat(p)
+		if err != nil {
+			b.Fatal(err)
+		}
+		total += fi.Size()
+	}
+
+	b.Run("pooled", func(b *testing.B) {
+		b.SetBytes(total)
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			hashFiles(b, paths, 8, readChunks, func(buf *[]byte) { hashBuffers.Put(buf) })
+		}
+	})
+	b.Run("unpooled", func(b *testing.B) {
+		b.SetBytes(total)
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			hashFiles(b, paths, 8, readChunksUnpooled, func(*[]byte) {})
+		}
+	})
+}
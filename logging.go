@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// logLevel 控制输出的详细程度
+type logLevel int
+
+const (
+	levelQuiet   logLevel = iota // 只输出错误
+	levelInfo                    // 默认：进度和最终汇总
+	levelVerbose                 // 额外输出每个文件、目录的处理信息
+)
+
+var currentLevel = levelInfo
+var quietFlag bool
+var verboseFlag bool
+var jsonLogFlag bool // -log-json：日志信息输出为 JSON 行
+var logMu sync.Mutex
+
+// logOutput 是日志信息的输出位置，日志结果写到标准输出时改为标准错误，避免混在结果中
+var logOutput io.Writer = os.Stdout
+
+// diagOutput 是进度、警告和错误信息的输出位置，总是标准错误，标准输出只留给结果和汇总
+var diagOutput io.Writer = os.Stderr
+
+// addLogFlags 注册日志级别相关的参数
+func addLogFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&quietFlag, "quiet", false, "only print errors, no progress or summaries")
+	fs.BoolVar(&verboseFlag, "verbose", false, "also print per-file and per-directory messages")
+	fs.BoolVar(&jsonLogFlag, "log-json", false, "print log events (scan_start, progress, file, error, scan_done, message) as JSON lines with event, level and ts fields")
+}
+
+// applyLogFlags 根据 -quiet/-verbose 设置日志级别，两者不能同时使用
+func applyLogFlags() error {
+	switch {
+	case quietFlag && verboseFlag:
+		return errors.New("-quiet and -verbose are mutually exclusive")
+	case quietFlag:
+		currentLevel = levelQuiet
+	case verboseFlag:
+		currentLevel = levelVerbose
+	}
+	return nil
+}
+
+// verbosef 输出调试级别的信息，只在 -verbose 时显示
+func verbosef(format string, args ...interface{}) {
+	logf(levelVerbose, format, args...)
+}
+
+// infof 输出进度、汇总等常规信息，-quiet 时不显示
+func infof(format string, args ...interface{}) {
+	logf(levelInfo, format, args...)
+}
+
+// diagf 输出进度和警告，级别与 infof 相同，但写到标准错误
+func diagf(format string, args ...interface{}) {
+	logTo(diagOutput, levelInfo, format, args...)
+}
+
+// errorf 输出错误信息，任何级别下都会显示，写到标准错误
+func errorf(format string, args ...interface{}) {
+	logTo(diagOutput, levelQuiet, format, args...)
+}
+
+// logf 在当前级别不低于 level 时向 logOutput 输出一条文本信息
+func logf(level logLevel, format string, args ...interface{}) {
+	logTo(logOutput, level, format, args...)
+}
+
+// logTo 在当前级别不低于 level 时向 w 输出一条文本信息，-log-json 时包装成 "message" 事件
+func logTo(w io.Writer, level logLevel, format string, args ...interface{}) {
+	if currentLevel < level {
+		return
+	}
+	if jsonLogFlag {
+		writeEvent(w, level, "message", map[string]interface{}{"msg": strings.TrimRight(fmt.Sprintf(format, args...), "\n")})
+		return
+	}
+	fmt.Fprintf(w, format, args...)
+}
+
+// levelNames 是 JSON 事件中 level 字段的取值
+var levelNames = map[logLevel]string{levelQuiet: "error", levelInfo: "info", levelVerbose: "debug"}
+
+// logEvent 在 -log-json 时向 logOutput 输出一个结构化事件：fields 与 event、level、ts 字段一起写成一行 JSON。
+// 文本模式下什么也不做，调用者需要另外输出对应的文本
+func logEvent(level logLevel, event string, fields map[string]interface{}) {
+	writeEvent(logOutput, level, event, fields)
+}
+
+// diagEvent 与 logEvent 相同，但写到 diagOutput，用于进度、扫描开始和结束、错误这些在文本模式下由 diagf、errorf 输出的事件
+func diagEvent(level logLevel, event string, fields map[string]interface{}) {
+	writeEvent(diagOutput, level, event, fields)
+}
+
+// writeEvent 在 -log-json 且当前级别不低于 level 时向 w 输出一个事件
+func writeEvent(w io.Writer, level logLevel, event string, fields map[string]interface{}) {
+	if !jsonLogFlag || currentLevel < level {
+		return
+	}
+	line := map[string]interface{}{}
+	for k, v := range fields {
+		line[k] = v
+	}
+	line["event"] = event
+	line["level"] = levelNames[level]
+	line["ts"] = time.Now().UTC().Format(time.RFC3339Nano)
+	data, err := json.Marshal(line)
+	if err != nil {
+		return
+	}
+	// 多个 worker 会同时报告错误，一个事件必须一次写完
+	logMu.Lock()
+	w.Write(append(data, '\n'))
+	logMu.Unlock()
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// TestLogJSONOutputs 检查 -log-json 时进度、警告和错误事件与文本模式一样写到 diagOutput，只有结果信息留在 logOutput
+func TestLogJSONOutputs(t *testing.T) {
+	var out, diag bytes.Buffer
+	oldOut, oldDiag, oldJSON, oldLevel := logOutput, diagOutput, jsonLogFlag, currentLevel
+	logOutput, diagOutput, jsonLogFlag, currentLevel = &out, &diag, true, levelVerbose
+	t.Cleanup(func() { logOutput, diagOutput, jsonLogFlag, currentLevel = oldOut, oldDiag, oldJSON, oldLevel })
+
+	infof("Saved data to %s\n", "fav.log")
+	logEvent(levelVerbose, "file", map[string]interface{}{"path": "a.mkv"})
+	diagf("Warning: %s\n", "slow disk")
+	errorf("Error: %s\n", "boom")
+	diagEvent(levelInfo, "progress", map[string]interface{}{"files": 1})
+	diagEvent(levelInfo, "scan_done", map[string]interface{}{"files": 1})
+
+	for _, want := range []string{`"msg":"Saved data to fav.log"`, `"event":"file"`} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("logOutput is missing %s:\n%s", want, out.String())
+		}
+	}
+	for _, want := range []string{`"msg":"Warning: slow disk"`, `"msg":"Error: boom"`, `"event":"progress"`, `"event":"scan_done"`} {
+		if !strings.Contains(diag.String(), want) {
+			t.Errorf("diagOutput is missing %s:\n%s", want, diag.String())
+		}
+		if strings.Contains(out.String(), want) {
+			t.Errorf("logOutput contains %s, want it only on diagOutput", want)
+		}
+	}
+	if n := strings.Count(out.String(), "\n"); n != 2 {
+		t.Errorf("logOutput has %d lines, want 2:\n%s", n, out.String())
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// logEntry 是从日志中读出的一行。日志每行只有一个数值，所以 FileInfo 中只有对应的字段有值：
+// 按大小排序的日志只有 Size，按修改时间排序的日志只有 ModTime
+type logEntry struct {
+	Path string
+	FileInfo
+}
+
+// parseLog 解析 saveToFile 写出的 CSV 日志，是 writeCSV 的逆过程。每行为 "数值,路径"，
+// sortedByModTime 为 true 时数值是修改时间的 Unix 秒数（fav.log.sort），否则是字节数；
+// 路径按 CSV 规则去掉引号，相对路径保持日志中的原样
+func parseLog(r io.Reader, sortedByModTime bool) ([]logEntry, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = 2
+	var entries []logEntry
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		value, err := strconv.ParseInt(record[0], 10, 64)
+		if err != nil {
+			line, _ := cr.FieldPos(0)
+			column := "size"
+			if sortedByModTime {
+				column = "modification time"
+			}
+			return nil, fmt.Errorf("line %d: invalid %s %q", line, column, record[0])
+		}
+		e := logEntry{Path: record[1]}
+		if sortedByModTime {
+			e.ModTime = time.Unix(value, 0).UTC()
+		} else {
+			e.Size = value
+		}
+		entries = append(entries, e)
+	}
+}
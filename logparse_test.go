@@ -0,0 +1,146 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// withOutDir 在测试期间把 -out-dir 指向一个临时目录
+func withOutDir(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	old := outDirFlag
+	outDirFlag = dir
+	t.Cleanup(func() { outDirFlag = old })
+	return dir
+}
+
+// roundTripPaths 是会被加上引号、含逗号或引号的路径，写入日志再读回来应当保持不变
+var roundTripPaths = []string{
+	"/scan/plain.mkv",
+	"/scan/with space.mkv",
+	"/scan/a,b.mkv",
+	`/scan/foo"bar.mkv`,
+	`/scan/"quoted",and,commas".iso`,
+	"/scan/line\nbreak.bin",
+}
+
+func TestParseLogRoundTripSize(t *testing.T) {
+	withOutDir(t)
+	data := make(map[string]FileInfo)
+	var keys []string
+	for i, p := range roundTripPaths {
+		data[p] = FileInfo{Size: int64(1000 - i)}
+		keys = append(keys, p)
+	}
+	opts := saveOptions{absPaths: true}
+	if err := saveToFile("/scan", "fav.log", "csv", keys, data, sortSize, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := os.Open(outputPath("fav.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	entries, err := parseLog(file, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != len(keys) {
+		t.Fatalf("got %d entries, want %d", len(entries), len(keys))
+	}
+	for i, e := range entries {
+		if e.Path != keys[i] {
+			t.Errorf("entry %d: path %q, want %q", i, e.Path, keys[i])
+		}
+		if e.Size != data[keys[i]].Size {
+			t.Errorf("entry %d: size %d, want %d", i, e.Size, data[keys[i]].Size)
+		}
+	}
+}
+
+func TestParseLogRoundTripModTime(t *testing.T) {
+	withOutDir(t)
+	base := time.Date(2024, 3, 1, 12, 30, 45, 0, time.UTC)
+	data := make(map[string]FileInfo)
+	var keys []string
+	for i, p := range roundTripPaths {
+		// 日志只保存到秒，纳秒部分读回来时会被丢掉
+		data[p] = FileInfo{Size: 1, ModTime: base.Add(-time.Duration(i)*time.Hour + 250*time.Millisecond)}
+		keys = append(keys, p)
+	}
+	if err := saveToFile("/scan", "fav.log.sort", "csv", keys, data, sortMtime, saveOptions{absPaths: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := os.Open(outputPath("fav.log.sort"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	entries, err := parseLog(file, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != len(keys) {
+		t.Fatalf("got %d entries, want %d", len(entries), len(keys))
+	}
+	for i, e := range entries {
+		want := data[keys[i]].ModTime.Truncate(time.Second)
+		if e.Path != keys[i] || !e.ModTime.Equal(want) {
+			t.Errorf("entry %d: %q %s, want %q %s", i, e.Path, e.ModTime, keys[i], want)
+		}
+		if e.Size != 0 {
+			t.Errorf("entry %d: size %d, want 0 in an mtime log", i, e.Size)
+		}
+	}
+}
+
+func TestParseLogRelativePaths(t *testing.T) {
+	withOutDir(t)
+	root := filepath.FromSlash("/scan")
+	p := filepath.Join(root, "sub", "a,b.mkv")
+	data := map[string]FileInfo{p: {Size: 42}}
+	if err := saveToFile(root, "fav.log", "csv", []string{p}, data, sortSize, saveOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Open(outputPath("fav.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	entries, err := parseLog(file, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "./" + filepath.Join("sub", "a,b.mkv")
+	if len(entries) != 1 || entries[0].Path != want || entries[0].Size != 42 {
+		t.Errorf("got %+v, want one entry %q of 42 bytes", entries, want)
+	}
+}
+
+func TestParseLogErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		mtime bool
+		want  string
+	}{
+		{"bad size", "12x,\"./a\"\n", false, `line 1: invalid size "12x"`},
+		{"bad mtime", "100,\"./a\"\nnow,\"./b\"\n", true, `line 2: invalid modification time "now"`},
+		{"missing path", "100\n", false, "wrong number of fields"},
+		{"unterminated quote", "100,\"./a\n", false, "extraneous or missing"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseLog(strings.NewReader(tt.input), tt.mtime)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("parseLog(%q) error = %v, want it to contain %q", tt.input, err, tt.want)
+			}
+		})
+	}
+}
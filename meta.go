@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"runtime/debug"
+)
+
+// version 可以在构建时通过 -ldflags "-X main.version=v1.2.3" 指定，为空时使用模块的构建信息
+var version = ""
+
+// toolVersion 返回写入元数据的版本号
+func toolVersion() string {
+	if version != "" {
+		return version
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		return info.Main.Version
+	}
+	return "unknown"
+}
+
+// scanMeta 记录一次扫描的参数和结果，-meta 时写入 fav.log.meta，让日志可以追溯和复现
+type scanMeta struct {
+	Version     string           `json:"version"`
+	Roots       []string         `json:"roots"`
+	StartedAt   string           `json:"startedAt"`
+	FinishedAt  string           `json:"finishedAt"`
+	MinSize     int64            `json:"minSize"`
+	MaxSize     int64            `json:"maxSize,omitempty"` // -max-size，0 表示没有上限
+	SizeMode    string           `json:"sizeMode"`          // -apparent-vs-allocated，记录的是逻辑大小还是占用的磁盘空间
+	ExtMinSizes map[string]int64 `json:"extMinSizes,omitempty"`
+	Exclude     []string         `json:"exclude"`
+	Include     []string         `json:"include"`
+	ExcludeExts []string         `json:"excludeExts"`
+	Store       string           `json:"store"`
+	Namespace   string           `json:"namespace"`
+	HashAlgo    string           `json:"hashAlgo"`
+	Files       int64            `json:"files"`
+	Bytes       int64            `json:"bytes"`
+	Interrupted bool             `json:"interrupted"`
+	TimedOut    bool             `json:"timedOut"` // 是否因为 -max-duration 到期而提前停止
+}
+
+// saveMeta 把元数据写成缩进的 JSON，没有设置的列表写成 [] 而不是 null
+func saveMeta(filename string, meta scanMeta) error {
+	for _, list := range []*[]string{&meta.Exclude, &meta.Include, &meta.ExcludeExts} {
+		if *list == nil {
+			*list = []string{}
+		}
+	}
+	data, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return err
+	}
+	file, err := createOutputFile(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	file.Write(append(data, '\n'))
+	return file.commit()
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// metricsAddr 是 -metrics-addr 指定的监听地址，为空时不提供指标
+var metricsAddr string
+
+// metricsServer 是正在运行的指标服务；-watch 的每一轮共用同一个服务，由 runWatch 返回前关闭
+var metricsServer *http.Server
+
+var redisWriteNanos int64 // Total time spent in Redis pipeline writes
+var redisWrites int64     // Number of Redis pipeline writes
+
+// observeRedisWrite 记录一次 Redis 管道写入（包括重试）花费的时间
+func observeRedisWrite(d time.Duration) {
+	atomic.AddInt64(&redisWriteNanos, int64(d))
+	atomic.AddInt64(&redisWrites, 1)
+}
+
+// startMetrics 在 addr 上启动提供 /metrics 的 HTTP 服务，已经启动时什么也不做；
+// 先同步监听，端口被占用等错误直接返回
+func startMetrics(addr string) error {
+	if metricsServer != nil {
+		return nil
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", serveMetrics)
+	metricsServer = &http.Server{Handler: mux}
+	go metricsServer.Serve(ln)
+	diagf("Serving metrics on http://%s/metrics\n", ln.Addr())
+	return nil
+}
+
+// stopMetrics 关闭指标服务，最多等待正在处理的请求 5 秒
+func stopMetrics() {
+	if metricsServer == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	metricsServer.Shutdown(ctx)
+	metricsServer = nil
+}
+
+// serveMetrics 以 Prometheus 文本格式输出进度使用的计数器。-watch 每一轮开始时计数器清零，
+// Prometheus 的 rate() 会把它当作计数器重置处理
+func serveMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	metric := func(name, kind, help string, value interface{}) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %v\n", name, help, name, kind, name, value)
+	}
+	metric("filescanner_files_processed_total", "counter", "Matching files recorded by the current scan.", atomic.LoadInt32(&progressCounter))
+	metric("filescanner_bytes_processed_total", "counter", "Total size of the recorded files in bytes.", atomic.LoadInt64(&bytesCounter))
+	metric("filescanner_files_unchanged_total", "counter", "Recorded files whose cached entry was already up to date.", atomic.LoadInt64(&unchangedCounter))
+	metric("filescanner_entries_scanned_total", "counter", "Non-directory entries visited by the walk.", atomic.LoadInt64(&scannedCounter))
+	metric("filescanner_errors_total", "counter", "Errors recorded by the current scan.", scanErrors.count())
+
+	name := "filescanner_redis_write_seconds"
+	fmt.Fprintf(w, "# HELP %s Time spent writing pipelines to Redis, including retries.\n# TYPE %s summary\n", name, name)
+	fmt.Fprintf(w, "%s_sum %g\n%s_count %d\n", name, time.Duration(atomic.LoadInt64(&redisWriteNanos)).Seconds(), name, atomic.LoadInt64(&redisWrites))
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// runMigrate 实现 migrate 子命令：把 Redis 中旧格式（每个文件两个 key）的记录转换为每个文件一个 hash
+func runMigrate(args []string) {
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	addStoreFlags(fs)
+	addLogFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: ./find_large_files_with_cache migrate [options] <directory>...")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() < 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	if err := applyLogFlags(); err != nil {
+		fmt.Fprintln(fs.Output(), err)
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	// 目录参数只用来确定存储的命名空间
+	roots := fs.Args()
+	var err error
+	if len(roots) > 1 {
+		if roots, err = absRoots(roots); err != nil {
+			errorf("Error resolving directory: %s\n", err)
+			os.Exit(1)
+		}
+	}
+	if namespace == "" {
+		if namespace, err = defaultNamespace(roots); err != nil {
+			errorf("Error resolving directory: %s\n", err)
+			os.Exit(1)
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	store, err := openStore(ctx)
+	if err != nil {
+		errorf("Error opening store: %s\n", err)
+		os.Exit(1)
+	}
+	defer store.Close()
+
+	rs, ok := store.(*redisStore)
+	if !ok {
+		infof("Nothing to migrate for the %s store.\n", storeType)
+		return
+	}
+	migrated, err := rs.migrateLegacy(ctx)
+	infof("Migrated %d entries to the new format.\n", migrated)
+	if err != nil {
+		errorf("Error migrating entries: %s\n", err)
+		store.Close()
+		os.Exit(1)
+	}
+}
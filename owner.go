@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+	"github.com/huangyingw/FileSorter/scanner"
+	"os"
+)
+
+// captureOwner 由 -capture-owner 设置，为 true 时记录每个文件的 UID、GID 和权限位
+var captureOwner bool
+
+// formatOwner 把所有者编码为存储中保存的 "uid:gid:mode" 形式，mode 为八进制；没有所有者时返回空字符串
+func formatOwner(o *scanner.Owner) string {
+	if o == nil {
+		return ""
+	}
+	return fmt.Sprintf("%d:%d:%o", o.UID, o.GID, uint32(o.Mode))
+}
+
+// parseOwner 是 formatOwner 的逆过程，空字符串和无法解析的值返回 nil
+func parseOwner(s string) *scanner.Owner {
+	if s == "" {
+		return nil
+	}
+	var uid, gid, mode uint32
+	if n, err := fmt.Sscanf(s, "%d:%d:%o", &uid, &gid, &mode); err != nil || n != 3 {
+		return nil
+	}
+	return &scanner.Owner{UID: uid, GID: gid, Mode: os.FileMode(mode)}
+}
+
+// sameOwner 比较两个所有者，都为 nil 时也相同
+func sameOwner(a, b *scanner.Owner) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
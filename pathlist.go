@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"sync"
+)
+
+// pathList 不为 nil 时，countFile 把每个通过过滤的文件的路径写到这里，-path-list 使用它代替存储和日志
+var pathList *pathListWriter
+
+// pathListWriter 把路径逐行写入一个带缓冲的输出，会被多个 worker 并发调用。
+// 路径保持遍历得到的写法（根目录加相对路径），在当前目录下可以直接交给 xargs 等工具
+type pathListWriter struct {
+	mu    sync.Mutex
+	w     *bufio.Writer
+	file  *atomicFile // 输出到标准输出时为 nil
+	count int64
+	err   error // 第一次写入失败的错误
+}
+
+// newPathListWriter 创建 name 的路径列表，name 为 "-" 时写到标准输出；
+// 写到文件时先写临时文件，close 时再改名，失败的扫描不会留下半个列表
+func newPathListWriter(name string) (*pathListWriter, error) {
+	if name == "-" {
+		return &pathListWriter{w: bufio.NewWriter(os.Stdout)}, nil
+	}
+	file, err := createAtomicFile(name)
+	if err != nil {
+		return nil, err
+	}
+	return &pathListWriter{w: bufio.NewWriter(file), file: file}, nil
+}
+
+func (p *pathListWriter) add(path string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, err := io.WriteString(p.w, path+"\n"); err != nil && p.err == nil {
+		p.err = err
+	}
+	p.count++
+}
+
+// close 写出缓冲中剩下的路径，写到文件时改名为目标文件；返回写入的路径数和第一个错误
+func (p *pathListWriter) close() (int64, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	err := p.w.Flush()
+	if p.err != nil {
+		err = p.err
+	}
+	if p.file != nil {
+		if err != nil {
+			p.file.Close()
+		} else {
+			err = p.file.commit()
+		}
+	}
+	return p.count, err
+}
+
+// discard 放弃还没有开始写的列表，写到文件时删除临时文件
+func (p *pathListWriter) discard() {
+	if p.file != nil {
+		p.file.Close()
+	}
+}
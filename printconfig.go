@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"github.com/huangyingw/FileSorter/scanner"
+	"io"
+	"sort"
+	"strings"
+)
+
+// configWriter 按 "key=value" 每行一项写出配置；列表的每一项单独占一行，空列表写一行 "key="
+type configWriter struct {
+	w io.Writer
+}
+
+func (c configWriter) set(key string, value interface{}) {
+	fmt.Fprintf(c.w, "%s=%v\n", key, value)
+}
+
+func (c configWriter) list(key string, values []string) {
+	if len(values) == 0 {
+		c.set(key, "")
+	}
+	for _, v := range values {
+		c.set(key, v)
+	}
+}
+
+// printConfig 写出 -print-config 的结果：参数、环境变量和默认值合并之后这次扫描实际使用的设置，包括日志的完整路径。
+// 模式文件 excludeFiles 和 includeFiles 只列出路径，不读取；opts 中的 Exclude 和 Include 是命令行上给出的模式
+func printConfig(w io.Writer, opts scanner.Options, outputOpts saveOptions, workers int, excludeFiles, includeFiles []string) {
+	c := configWriter{w}
+	c.list("root", opts.Roots)
+	c.set("store", storeType)
+	switch storeType {
+	case "redis":
+		c.set("redis-addr", redisAddr)
+		c.set("redis-db", redisDB)
+		if redisPassword != "" {
+			c.set("redis-password", "(set)")
+		}
+	case "sqlite":
+		c.set("db", sqlitePath)
+	}
+	c.set("namespace", namespace)
+	c.set("hash-algo", hashAlgo)
+	c.set("min-size", opts.MinSize)
+	if opts.MaxSize > 0 {
+		c.set("max-size", opts.MaxSize)
+	} else {
+		c.set("max-size", "none")
+	}
+	if opts.AllocatedSize {
+		c.set("apparent-vs-allocated", "allocated")
+	} else {
+		c.set("apparent-vs-allocated", "apparent")
+	}
+	var exts []string
+	for ext := range opts.ExtMinSize {
+		exts = append(exts, ext)
+	}
+	sort.Strings(exts)
+	rules := make([]string, len(exts))
+	for i, ext := range exts {
+		rules[i] = fmt.Sprintf("ext=%s,min=%d", ext, opts.ExtMinSize[ext])
+	}
+	c.list("rule", rules)
+	c.list("exclude-file", excludeFiles)
+	c.list("exclude", opts.Exclude)
+	c.set("exclude-ignore-case", opts.ExcludeIgnoreCase)
+	c.list("exclude-path", opts.ExcludePaths)
+	c.list("include-file", includeFiles)
+	c.list("include", opts.Include)
+	var excludeExts []string
+	for _, ext := range opts.ExcludeExts {
+		if ext = strings.TrimSpace(ext); ext != "" {
+			excludeExts = append(excludeExts, ext)
+		}
+	}
+	c.list("exclude-ext", excludeExts)
+	c.list("skip-fstypes", opts.SkipFSTypes)
+	c.set("skip-hidden", opts.SkipHidden)
+	c.set("max-depth", opts.MaxDepth)
+	c.set("follow-symlinks", opts.FollowSymlinks)
+	c.set("dedupe-hardlinks", opts.DedupeHardlinks)
+	c.set("scan-archives", opts.ScanArchives)
+	c.set("ignore-file", opts.IgnoreFile)
+	c.set("workers", workers)
+	c.set("dry-run", dryRun)
+
+	sorts := outputOpts.sorts
+	if len(sorts) == 0 {
+		sorts = defaultSortKeys
+	}
+	names := make([]string, len(sorts))
+	for i, k := range sorts {
+		names[i] = string(k)
+	}
+	c.set("sort", strings.Join(names, ","))
+	c.set("reverse", outputOpts.reverse)
+	c.set("format", outputOpts.format)
+	c.set("compress", outputOpts.compress)
+	c.set("top", outputOpts.top)
+	c.set("abs-paths", outputOpts.absPaths)
+	c.set("out-dir", outDirFlag)
+	if outputOpts.output == "-" {
+		c.set("log", "(stdout)")
+		return
+	}
+	for _, k := range sorts {
+		for _, format := range outputOpts.formats() {
+			c.set("log", outputPath(outputFilename(k.logName(), format, outputOpts)))
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"github.com/karrick/godirwalk"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+var scannedCounter int64 // Non-directory entries visited by the walk
+
+// formatBytes 把字节数格式化为带二进制单位的字符串，例如 "3.2 GiB"
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit && exp < 5; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// formatCount 用千位分隔符格式化计数，例如 "1,234,567"
+func formatCount(n int64) string {
+	s := strconv.FormatInt(n, 10)
+	start := 0
+	if n < 0 {
+		start = 1
+	}
+	for i := len(s) - 3; i > start; i -= 3 {
+		s = s[:i] + "," + s[i:]
+	}
+	return s
+}
+
+// countEntries 快速遍历一遍目录树，只统计非目录条目的数量而不做 stat，
+// 用作进度百分比和 ETA 的分母
+func countEntries(rootDir string) (int64, error) {
+	var total int64
+	err := godirwalk.Walk(rootDir, &godirwalk.Options{
+		Callback: func(osPathname string, de *godirwalk.Dirent) error {
+			if !de.IsDir() {
+				total++
+			}
+			return nil
+		},
+		Unsorted: true,
+	})
+	return total, err
+}
+
+// progressFields 返回 -log-json 时 "progress" 和 "scan_done" 事件中的计数
+func progressFields(elapsed time.Duration, total int64) map[string]interface{} {
+	fields := map[string]interface{}{
+		"files":           atomic.LoadInt32(&progressCounter),
+		"size":            atomic.LoadInt64(&bytesCounter),
+		"unchanged":       atomic.LoadInt64(&unchangedCounter),
+		"scanned":         atomic.LoadInt64(&scannedCounter),
+		"elapsed_seconds": elapsed.Seconds(),
+	}
+	if total > 0 {
+		fields["total"] = total
+	}
+	return fields
+}
+
+// progressLine 生成一行进度信息，total > 0 时附带已遍历的百分比和预计剩余时间
+func progressLine(elapsed time.Duration, total int64) string {
+	processed := atomic.LoadInt32(&progressCounter)
+	bytes := atomic.LoadInt64(&bytesCounter)
+	seconds := elapsed.Seconds()
+	if seconds <= 0 {
+		seconds = 1
+	}
+
+	line := fmt.Sprintf("Progress: %s files processed, %s, %.1f files/s, %s/s",
+		formatCount(int64(processed)), formatBytes(bytes), float64(processed)/seconds, formatBytes(int64(float64(bytes)/seconds)))
+	if unchanged := atomic.LoadInt64(&unchangedCounter); unchanged > 0 {
+		line += fmt.Sprintf(", %d unchanged", unchanged)
+	}
+	if total > 0 {
+		scanned := atomic.LoadInt64(&scannedCounter)
+		percent := float64(scanned) / float64(total) * 100
+		if percent > 100 {
+			percent = 100
+		}
+		line += fmt.Sprintf(", %.1f%% scanned", percent)
+		if scanned > 0 && scanned < total {
+			eta := time.Duration(float64(elapsed) * float64(total-scanned) / float64(scanned))
+			line += fmt.Sprintf(", ETA %s", eta.Round(time.Second))
+		}
+	}
+	return line + "."
+}
+
+// statusLine 在进度信息后附上已经过的时间，用作 -progress-file 的内容
+func statusLine(line string, elapsed time.Duration) string {
+	return fmt.Sprintf("%s Elapsed %s.\n", line, elapsed.Round(time.Second))
+}
+
+// writeStatusFile 先写临时文件再重命名，读取状态文件的一方不会看到写了一半的内容
+func writeStatusFile(name, content string) error {
+	file, err := createAtomicFile(name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	file.Write([]byte(content))
+	return file.commit()
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/huangyingw/FileSorter/scanner"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// readLogFile 读取输出目录中 saveToFile 写出的 CSV 日志，把相对于 dir 的路径还原为扫描时的路径
+func readLogFile(dir, filename string) ([]logEntry, error) {
+	file, err := os.Open(outputPath(filename))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	entries, err := parseLog(file, false)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", filename, err)
+	}
+	for i, e := range entries {
+		if !filepath.IsAbs(e.Path) {
+			entries[i].Path = filepath.Join(dir, e.Path)
+		}
+	}
+	return entries, nil
+}
+
+// moveFile 把文件移动到 destDir 下，跨文件系统时退回到复制后删除；不会覆盖已有文件
+func moveFile(path, destDir string) error {
+	dest := filepath.Join(destDir, filepath.Base(path))
+	if _, err := os.Lstat(dest); err == nil {
+		return fmt.Errorf("%s already exists", dest)
+	}
+	err := os.Rename(path, dest)
+	if err == nil || !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		os.Remove(dest)
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		os.Remove(dest)
+		return err
+	}
+	return os.Remove(path)
+}
+
+// runPrune 实现 prune 子命令：逐条读取 fav.log，确认后删除文件或移动到 -move-to 目录，
+// 并删除存储中对应的记录
+func runPrune(args []string) {
+	fs := flag.NewFlagSet("prune", flag.ExitOnError)
+	yes := fs.Bool("yes", false, "act on every entry without asking")
+	moveTo := fs.String("move-to", "", "move files into this directory instead of deleting them")
+	fs.StringVar(&sizeLogName, "out", "fav.log", "name of the log to read, as given to -out when scanning")
+	addStoreFlags(fs)
+	addOutDirFlag(fs)
+	addLogFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: ./find_large_files_with_cache prune [options] <directory>...")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() < 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	if err := applyLogFlags(); err != nil {
+		fmt.Fprintln(fs.Output(), err)
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	// 目录参数与扫描时相同，用来还原 fav.log 中的相对路径和定位存储的命名空间
+	roots := fs.Args()
+	for _, root := range roots {
+		if scanner.IsRemote(root) {
+			fmt.Fprintf(fs.Output(), "prune only works on local directories, not %s\n", root)
+			fs.Usage()
+			os.Exit(2)
+		}
+	}
+	var err error
+	if len(roots) > 1 {
+		if roots, err = absRoots(roots); err != nil {
+			errorf("Error resolving directory: %s\n", err)
+			os.Exit(1)
+		}
+	}
+	dir := pathBase(roots)
+	if namespace == "" {
+		if namespace, err = defaultNamespace(roots); err != nil {
+			errorf("Error resolving directory: %s\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if *moveTo != "" {
+		if info, err := os.Stat(*moveTo); err != nil || !info.IsDir() {
+			fmt.Fprintf(fs.Output(), "Invalid -move-to: %s is not a directory\n", *moveTo)
+			fs.Usage()
+			os.Exit(2)
+		}
+	}
+
+	entries, err := readLogFile(dir, sizeLogName)
+	if err != nil {
+		errorf("Error reading log: %s\n", err)
+		os.Exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	store, err := openStore(ctx)
+	if err != nil {
+		errorf("Error opening store: %s\n", err)
+		os.Exit(1)
+	}
+	defer store.Close()
+
+	action := "Delete"
+	if *moveTo != "" {
+		action = "Move"
+	}
+	stdin := bufio.NewReader(os.Stdin)
+	var prunedFiles, skippedFiles int
+	var reclaimed int64
+prompt:
+	for _, entry := range entries {
+		if ctx.Err() != nil {
+			break
+		}
+
+		// 压缩包中的文件不能单独删除
+		if scanner.IsArchiveEntry(entry.Path) {
+			infof("Skipping %s: inside an archive\n", entry.Path)
+			skippedFiles++
+			continue
+		}
+		// 扫描之后文件可能已被修改或替换，只处理大小与日志一致的普通文件
+		info, err := os.Lstat(entry.Path)
+		if err != nil {
+			scanErrors.add("stat", entry.Path, err)
+			continue
+		}
+		if !info.Mode().IsRegular() || info.Size() != entry.Size {
+			infof("Skipping %s: changed since the scan\n", entry.Path)
+			skippedFiles++
+			continue
+		}
+
+		if !*yes {
+			fmt.Printf("%s %s (%s)? [y/N/q] ", action, entry.Path, formatBytes(entry.Size))
+			answer, err := stdin.ReadString('\n')
+			answer = strings.ToLower(strings.TrimSpace(answer))
+			switch {
+			case answer == "q":
+				break prompt
+			case answer != "y" && answer != "yes":
+				skippedFiles++
+				if err != nil {
+					// 标准输入已经结束，剩下的条目都不再询问
+					fmt.Println()
+					break prompt
+				}
+				continue
+			}
+		}
+
+		if *moveTo != "" {
+			err = moveFile(entry.Path, *moveTo)
+		} else {
+			err = os.Remove(entry.Path)
+		}
+		if err != nil {
+			scanErrors.add("prune", entry.Path, err)
+			continue
+		}
+		prunedFiles++
+		reclaimed += entry.Size
+		verbosef("%sd %s\n", action, entry.Path)
+
+		if err := store.Delete(ctx, entry.Path); err != nil {
+			scanErrors.add("store", entry.Path, err)
+		}
+	}
+
+	if *moveTo != "" {
+		infof("Moved %d files (%s) to %s, skipped %d.\n", prunedFiles, formatBytes(reclaimed), *moveTo, skippedFiles)
+	} else {
+		infof("Deleted %d files, reclaimed %s, skipped %d.\n", prunedFiles, formatBytes(reclaimed), skippedFiles)
+	}
+	if code := reportErrors(false); code != 0 {
+		store.Close()
+		os.Exit(code)
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// runReport 实现 report 子命令：直接读取存储中已有的扫描缓存，
+// 按新的参数重新生成日志，不再遍历文件系统
+func runReport(args []string) {
+	fs := flag.NewFlagSet("report", flag.ExitOnError)
+	var outputOpts saveOptions
+	minFlag := fs.String("min", "0", "only report files at least this large, e.g. 500M, 2G or a byte count")
+	maxFlag := fs.String("max", "", "only report files at most this large; empty means no upper limit")
+	addStoreFlags(fs)
+	addOutputFlags(fs, &outputOpts)
+	addOutDirFlag(fs)
+	addLogFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: ./find_large_files_with_cache report [options] <directory>...")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() < 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	if err := applyLogFlags(); err != nil {
+		fmt.Fprintln(fs.Output(), err)
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	// 与扫描时一样：多个目录时输出绝对路径，日志写入当前目录
+	roots := fs.Args()
+	var err error
+	if len(roots) > 1 {
+		if roots, err = absRoots(roots); err != nil {
+			errorf("Error resolving directory: %s\n", err)
+			os.Exit(1)
+		}
+		outputOpts.absPaths = true
+	}
+	dir := pathBase(roots)
+	if namespace == "" {
+		if namespace, err = defaultNamespace(roots); err != nil {
+			errorf("Error resolving directory: %s\n", err)
+			os.Exit(1)
+		}
+	}
+
+	minSize, err := parseSize(*minFlag)
+	if err != nil {
+		fmt.Fprintf(fs.Output(), "Invalid -min: %s\n", err)
+		fs.Usage()
+		os.Exit(2)
+	}
+	outputOpts.minSize = minSize
+	if *maxFlag != "" {
+		if outputOpts.maxSize, err = parseSize(*maxFlag); err != nil {
+			fmt.Fprintf(fs.Output(), "Invalid -max: %s\n", err)
+			fs.Usage()
+			os.Exit(2)
+		}
+	}
+
+	if err := validateOutputOptions(outputOpts); err != nil {
+		fmt.Fprintln(fs.Output(), err)
+		fs.Usage()
+		os.Exit(2)
+	}
+	if outputOpts.output == "-" {
+		logOutput = os.Stderr
+	}
+	if err := createOutDir(); err != nil {
+		errorf("Error creating output directory: %s\n", err)
+		os.Exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	store, err := openStore(ctx)
+	if err != nil {
+		errorf("Error opening store: %s\n", err)
+		os.Exit(1)
+	}
+	defer store.Close()
+
+	empty, err := storeIsEmpty(ctx, store)
+	if err != nil {
+		errorf("Error reading cache: %s\n", err)
+		os.Exit(1)
+	}
+	if empty {
+		errorf("Error: the cache is empty, run a scan first\n")
+		os.Exit(1)
+	}
+
+	saveLogs(ctx, store, dir, outputOpts)
+	if code := reportErrors(false); code != 0 {
+		store.Close()
+		os.Exit(code)
+	}
+}
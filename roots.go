@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"github.com/huangyingw/FileSorter/scanner"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// readRootList 读取换行分隔的根目录列表，name 为 "-" 时从标准输入读取，空行会被忽略
+func readRootList(name string) ([]string, error) {
+	var r io.Reader = os.Stdin
+	if name != "-" {
+		file, err := os.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		r = file
+	}
+
+	var roots []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if root := strings.TrimSpace(scanner.Text()); root != "" {
+			roots = append(roots, root)
+		}
+	}
+	return roots, scanner.Err()
+}
+
+// absRoots 把所有本地根目录转换为绝对路径，sftp:// 形式的远程根目录保持不变。
+// 多个根目录的结果合并在一个日志中，只有绝对路径才能区分来自不同根目录的文件
+func absRoots(roots []string) ([]string, error) {
+	abs := make([]string, len(roots))
+	for i, root := range roots {
+		if scanner.IsRemote(root) {
+			abs[i] = root
+			continue
+		}
+		p, err := filepath.Abs(root)
+		if err != nil {
+			return nil, err
+		}
+		abs[i] = p
+	}
+	return abs, nil
+}
+
+// redundantRoot 是被 dedupeRoots 去掉的根目录，Inside 是包含它的根目录
+type redundantRoot struct {
+	Root   string
+	Inside string
+}
+
+// dedupeRoots 去掉与其他根目录重复或位于其他根目录之下的根目录，避免其中的文件被扫描和统计两次。
+// 比较时使用解析了软链接的绝对路径，保留下来的根目录保持原来的写法和顺序；
+// sftp:// 形式的远程根目录只去掉完全相同的
+func dedupeRoots(roots []string) (kept []string, dropped []redundantRoot) {
+	resolved := make([]string, len(roots))
+	for i, root := range roots {
+		resolved[i] = root
+		if scanner.IsRemote(root) {
+			continue
+		}
+		if abs, err := filepath.Abs(root); err == nil {
+			resolved[i] = abs
+			// 不存在的根目录无法解析软链接，保留绝对路径，遍历时再报告错误
+			if real, err := filepath.EvalSymlinks(abs); err == nil {
+				resolved[i] = real
+			}
+		}
+	}
+
+	// 先保留路径较短的根目录，相同的根目录保留先出现的那个
+	order := make([]int, len(roots))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return len(resolved[order[i]]) < len(resolved[order[j]])
+	})
+	keep := make([]bool, len(roots))
+	inside := make([]string, len(roots))
+	for _, i := range order {
+		keep[i] = true
+		for _, j := range order {
+			if !keep[j] || j == i {
+				continue
+			}
+			if resolved[i] == resolved[j] || (!scanner.IsRemote(roots[i]) && isSubpath(resolved[j], resolved[i])) {
+				keep[i] = false
+				inside[i] = roots[j]
+				break
+			}
+		}
+	}
+	for i, root := range roots {
+		if keep[i] {
+			kept = append(kept, root)
+		} else {
+			dropped = append(dropped, redundantRoot{Root: root, Inside: inside[i]})
+		}
+	}
+	return kept, dropped
+}
+
+// isSubpath 判断 path 是否位于 dir 之下，两者都应当是清理过的绝对路径
+func isSubpath(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != "." && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// defaultNamespace 根据根目录的绝对路径生成默认的命名空间，同一组目录的多次扫描共用一份缓存。
+// 命名空间总是用 SHA-256 生成，不随 -hash-algo 变化
+func defaultNamespace(roots []string) (string, error) {
+	abs, err := absRoots(roots)
+	if err != nil {
+		return "", err
+	}
+	sort.Strings(abs)
+	sum := sha256.Sum256([]byte(strings.Join(abs, "\n")))
+	return hex.EncodeToString(sum[:])[:16], nil
+}
+
+// outDirFlag 是 -out-dir 指定的日志输出目录
+var outDirFlag = "."
+
+// addOutDirFlag 注册 -out-dir 参数，扫描、report 和 prune 子命令共用
+func addOutDirFlag(fs *flag.FlagSet) {
+	fs.StringVar(&outDirFlag, "out-dir", ".", "directory to write fav.log and the other logs to, created if missing; paths in the logs stay relative to the scanned directory")
+}
+
+// outputPath 返回日志文件 name 在输出目录中的路径
+func outputPath(name string) string {
+	return filepath.Join(outDirFlag, name)
+}
+
+// createOutDir 创建输出目录，已存在时什么也不做
+func createOutDir() error {
+	return os.MkdirAll(outDirFlag, 0755)
+}
+
+// pathBase 返回日志中相对路径的起点：只有一个根目录时为根目录，多个根目录时为当前目录（此时输出绝对路径）
+func pathBase(roots []string) string {
+	if len(roots) == 1 {
+		return roots[0]
+	}
+	return "."
+}
+
+// displayPath 返回写入日志的路径：absPaths 为 true 时输出绝对路径，否则输出相对 dir 的 "./..." 形式；
+// 不在 dir 之下的路径（例如跟随软链接得到的目标）也输出绝对路径，避免出现 "../../.." 这样的路径
+func displayPath(dir, path string, absPaths bool) string {
+	if !absPaths {
+		relativePath, err := filepath.Rel(dir, path)
+		if err == nil && relativePath == "." {
+			return "."
+		}
+		if err == nil && relativePath != ".." && !strings.HasPrefix(relativePath, ".."+string(filepath.Separator)) {
+			return "./" + relativePath
+		}
+	}
+	if scanner.IsRemote(path) {
+		return path
+	}
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
+
+// outputExcludes 把扫描自己写出的文件换算成各个本地根目录下的路径，作为 scanner 的 ExcludePaths：
+// 输出目录、-progress-file 或 SQLite 数据库位于某个根目录之下时，它们不会被当作普通文件记录。
+// files 中的每一项是一个文件路径，最后一段可以含通配符
+func outputExcludes(roots, files []string) []string {
+	var excludes []string
+	for _, root := range roots {
+		if scanner.IsRemote(root) {
+			continue
+		}
+		absRoot, err := filepath.Abs(root)
+		if err != nil {
+			continue
+		}
+		for _, f := range files {
+			absFile, err := filepath.Abs(f)
+			if err != nil {
+				continue
+			}
+			rel, err := filepath.Rel(absRoot, filepath.Dir(absFile))
+			if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+				continue
+			}
+			excludes = append(excludes, filepath.Join(root, rel, filepath.Base(absFile)))
+		}
+	}
+	return excludes
+}
+
+// selfOutputFiles 返回这次扫描可能写出的文件：输出目录中各个日志和运行报告（含 .json/.gz 后缀和写入时的临时文件）、
+// -progress-file、-path-list 以及 -store sqlite 的数据库和它的日志文件
+func selfOutputFiles(progressFile, pathListFile string) []string {
+	var files []string
+	seen := make(map[string]bool)
+	// fav.log.meta、fav.log.dupes 等日志都以 "fav.log" 开头
+	for _, name := range []string{sizeLogName, mtimeLogName, "fav.log", runReportName} {
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		files = append(files, outputPath(name+"*"), outputPath("."+name+"*"))
+	}
+	for _, f := range []string{progressFile, pathListFile} {
+		if f != "" && f != "-" {
+			files = append(files, f, filepath.Join(filepath.Dir(f), "."+filepath.Base(f)+".tmp-*"))
+		}
+	}
+	if storeType == "sqlite" {
+		files = append(files, sqlitePath+"*")
+	}
+	return files
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"github.com/huangyingw/FileSorter/scanner"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+// writeFiles 在 dir 下创建给出的文件（相对路径），内容为 100 个字节
+func writeFiles(t *testing.T, dir string, names ...string) {
+	t.Helper()
+	for _, name := range names {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, make([]byte, 100), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// scanPaths 扫描 roots，排除 excludes，返回找到的文件相对于 base 的路径
+func scanPaths(t *testing.T, base string, roots, excludes []string) []string {
+	t.Helper()
+	files, err := scanner.Scan(context.Background(), scanner.Options{
+		Roots:        roots,
+		MaxDepth:     -1,
+		ExcludePaths: excludes,
+		OnError:      func(err *scanner.Error) { t.Errorf("scan error: %v", err) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	for f := range files {
+		abs, err := filepath.Abs(f.Path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rel, err := filepath.Rel(base, abs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, filepath.ToSlash(rel))
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// selfOutputFixture 是输出目录 out 和 -progress-file status.txt 都位于根目录之下时，根目录中的文件
+var selfOutputFixture = []string{
+	"data/film.mkv",
+	"data/fav.log",  // 不在输出目录中，是普通文件
+	"out/notes.txt", // 输出目录中不是扫描写出的文件
+	"out/fav.log",   // 以下都是扫描自己写出的文件
+	"out/fav.log.sort",
+	"out/fav.log.meta",
+	"out/fav.log.json.gz",
+	"out/.fav.log.tmp-12345",
+	"out/.fav.log.sort.tmp-1",
+	"out/fav.report.json",
+	"out/.fav.report.json.tmp-7",
+	"status.txt",
+	".status.txt.tmp-99",
+}
+
+var selfOutputKept = []string{"data/fav.log", "data/film.mkv", "out/notes.txt"}
+
+func withSelfOutputFlags(t *testing.T, outDir string) {
+	t.Helper()
+	oldOut, oldStore := outDirFlag, storeType
+	outDirFlag, storeType = outDir, "memory"
+	t.Cleanup(func() { outDirFlag, storeType = oldOut, oldStore })
+}
+
+func TestSelfOutputExcludedInsideRoot(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, selfOutputFixture...)
+	withSelfOutputFlags(t, filepath.Join(root, "out"))
+
+	roots := []string{root}
+	excludes := outputExcludes(roots, selfOutputFiles(filepath.Join(root, "status.txt"), ""))
+	if got := scanPaths(t, root, roots, excludes); !equalStrings(got, selfOutputKept) {
+		t.Errorf("got %q, want %q", got, selfOutputKept)
+	}
+}
+
+// TestSelfOutputExcludedRelativeRoot 用 "." 作为根目录、相对路径的 -out-dir 和 -progress-file，
+// 遍历得到的路径没有 "./" 前缀，排除的路径也要用同样的写法
+func TestSelfOutputExcludedRelativeRoot(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, selfOutputFixture...)
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(root); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+	withSelfOutputFlags(t, "out")
+
+	roots := []string{"."}
+	excludes := outputExcludes(roots, selfOutputFiles("status.txt", ""))
+	realRoot, err := filepath.Abs(".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := scanPaths(t, realRoot, roots, excludes); !equalStrings(got, selfOutputKept) {
+		t.Errorf("got %q, want %q", got, selfOutputKept)
+	}
+}
+
+func TestSelfOutputExcludesPathList(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, "film.mkv", "paths.txt", ".paths.txt.tmp-1")
+	withSelfOutputFlags(t, t.TempDir())
+
+	roots := []string{root}
+	excludes := outputExcludes(roots, selfOutputFiles("", filepath.Join(root, "paths.txt")))
+	if got, want := scanPaths(t, root, roots, excludes), []string{"film.mkv"}; !equalStrings(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestOutputExcludesOutsideRoot(t *testing.T) {
+	root, out := t.TempDir(), t.TempDir()
+	withSelfOutputFlags(t, out)
+	if excludes := outputExcludes([]string{root}, selfOutputFiles(filepath.Join(out, "status.txt"), "-")); len(excludes) != 0 {
+		t.Errorf("got excludes %q for an output directory outside the root", excludes)
+	}
+	// 远程根目录没有本地路径可以比较
+	if excludes := outputExcludes([]string{"sftp://u@h/data"}, []string{"/data/fav.log"}); len(excludes) != 0 {
+		t.Errorf("got excludes %q for a remote root", excludes)
+	}
+}
+
+// TestDisplayPathRelativeAndAbsoluteRoot 检查根目录写成 "." 和写成绝对路径时日志中的路径相同
+func TestDisplayPathRelativeAndAbsoluteRoot(t *testing.T) {
+	root, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(root); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	outside := filepath.Join(filepath.Dir(root), "elsewhere", "b.mkv")
+	tests := []struct {
+		rel      string // 根目录为 "." 时遍历得到的路径
+		absPaths bool
+		want     string
+	}{
+		{filepath.Join("sub", "a.mkv"), false, "./" + filepath.Join("sub", "a.mkv")},
+		{"a.mkv", false, "./a.mkv"},
+		{".", false, "."},
+		{filepath.Join("sub", "a.mkv"), true, filepath.Join(root, "sub", "a.mkv")},
+	}
+	for _, tt := range tests {
+		fromDot := displayPath(".", tt.rel, tt.absPaths)
+		fromAbs := displayPath(root, filepath.Join(root, tt.rel), tt.absPaths)
+		if fromDot != tt.want || fromAbs != tt.want {
+			t.Errorf("displayPath of %q (absPaths %v): %q with root \".\", %q with root %q, want %q",
+				tt.rel, tt.absPaths, fromDot, fromAbs, root, tt.want)
+		}
+	}
+	// 不在根目录之下的路径两种写法都输出绝对路径
+	relOutside, err := filepath.Rel(root, outside)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := displayPath(".", relOutside, false); got != outside {
+		t.Errorf("displayPath(\".\", %q) = %q, want %q", relOutside, got, outside)
+	}
+	if got := displayPath(root, outside, false); got != outside {
+		t.Errorf("displayPath(%q, %q) = %q, want %q", root, outside, got, outside)
+	}
+}
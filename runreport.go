@@ -0,0 +1,106 @@
+package main
+
+import "encoding/json"
+
+// runReportName 是 -json-config 写出的运行报告
+const runReportName = "fav.report.json"
+
+// scanReport 把一次扫描的汇总、最大的文件、扩展名统计和重复文件组放在一个 JSON 文档中，
+// 供仪表盘一次读取；没有开启的分析对应的部分不输出
+type scanReport struct {
+	Version    string        `json:"version"`
+	Roots      []string      `json:"roots"`
+	StartedAt  string        `json:"startedAt"`
+	FinishedAt string        `json:"finishedAt"`
+	Summary    reportSummary `json:"summary"`
+	Largest    []jsonEntry   `json:"largest"`
+	Extensions *reportExts   `json:"extensions,omitempty"` // 只在 -by-ext 时输出
+	Duplicates *reportDupes  `json:"duplicates,omitempty"` // 只在 -find-dupes 时输出
+}
+
+// reportSummary 与易读汇总和 Final 行中的数字相同
+type reportSummary struct {
+	Files          int64   `json:"files"`
+	Bytes          int64   `json:"bytes"`
+	Unchanged      int64   `json:"unchanged"`
+	Errors         int     `json:"errors"`
+	ElapsedSeconds float64 `json:"elapsedSeconds"`
+	Interrupted    bool    `json:"interrupted"`
+	TimedOut       bool    `json:"timedOut"`
+}
+
+// reportExts 是 fav.log.ext 的内容，MinSize 是 -ext-min-size
+type reportExts struct {
+	MinSize int64       `json:"minSize"`
+	Entries []reportExt `json:"entries"`
+}
+
+type reportExt struct {
+	Ext   string `json:"ext"`
+	Size  int64  `json:"size"`
+	Count int64  `json:"count"`
+}
+
+// reportDupes 是 fav.log.dupes 的内容，按浪费的空间从大到小排序
+type reportDupes struct {
+	Groups  int          `json:"groups"`
+	Wasted  int64        `json:"wasted"`
+	Entries []reportDupe `json:"entries"`
+}
+
+type reportDupe struct {
+	Hash   string   `json:"hash"`
+	Size   int64    `json:"size"`
+	Wasted int64    `json:"wasted"`
+	Paths  []string `json:"paths"`
+}
+
+// newReportDupes 转换重复文件组，路径按 displayPath 的规则输出
+func newReportDupes(groups []dupeGroup, dir string, absPaths bool) *reportDupes {
+	dupes := &reportDupes{Groups: len(groups), Entries: []reportDupe{}}
+	for _, g := range groups {
+		paths := make([]string, len(g.Paths))
+		for i, p := range g.Paths {
+			paths[i] = displayPath(dir, p, absPaths)
+		}
+		dupes.Wasted += g.waste()
+		dupes.Entries = append(dupes.Entries, reportDupe{Hash: g.Hash, Size: g.Size, Wasted: g.waste(), Paths: paths})
+	}
+	return dupes
+}
+
+// newReportExts 转换扩展名统计，top > 0 时只保留总大小最大的 top 个，与 fav.log.ext 一致
+func newReportExts(totals *extTotals, minSize int64, top int) *reportExts {
+	exts := &reportExts{MinSize: minSize, Entries: []reportExt{}}
+	for _, row := range totals.sorted(top) {
+		exts.Entries = append(exts.Entries, reportExt{Ext: row.Ext, Size: row.Size, Count: row.Count})
+	}
+	return exts
+}
+
+// newReportFiles 把最大的文件转换为与 -format json 相同的形式
+func newReportFiles(entries []fileEntry, dir string, absPaths bool) []jsonEntry {
+	files := make([]jsonEntry, len(entries))
+	for i, e := range entries {
+		files[i] = newJSONEntry(dir, e.Path, e.Info, absPaths)
+	}
+	return files
+}
+
+// saveRunReport 把运行报告写成缩进的 JSON
+func saveRunReport(filename string, report scanReport) error {
+	if report.Largest == nil {
+		report.Largest = []jsonEntry{}
+	}
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	file, err := createOutputFile(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	file.Write(append(data, '\n'))
+	return file.commit()
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+)
+
+// envFlags 是默认值取自环境变量的参数。优先级从低到高为：默认值、配置文件、环境变量、命令行参数，
+// 所以环境变量设置了时配置文件中的值不生效
+var envFlags = map[string]string{
+	"redis-addr":     "REDIS_ADDR",
+	"redis-password": "REDIS_PASSWORD",
+}
+
+// applyConfigFile 读取 -config 指定的 JSON 配置文件并设置 fs 中的参数，返回其中的 "roots"。
+// 除 "roots" 外每个 key 都是去掉 "-" 的参数名，值可以是字符串、数字或布尔值，例如
+//
+//	{"roots": ["/data"], "min-size": "500M", "store": "sqlite", "exclude": ["*.tmp", "cache"]}
+//
+// -exclude、-include 这类可以重复指定的参数可以写成数组。命令行上已经给出的参数不会被覆盖，
+// 不认识的 key 会报错，避免拼错的选项被悄悄忽略；路径和命令行参数一样相对于当前目录
+func applyConfigFile(fs *flag.FlagSet, filename string) ([]string, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var values map[string]interface{}
+	if err := dec.Decode(&values); err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+
+	explicit := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+
+	var roots []string
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if key == "roots" {
+			if roots, err = configStrings(values[key], true); err != nil {
+				return nil, fmt.Errorf("%s: roots: %w", filename, err)
+			}
+			continue
+		}
+		f := fs.Lookup(key)
+		if f == nil || key == "config" {
+			return nil, fmt.Errorf("%s: unknown option %q", filename, key)
+		}
+		list, err := configStrings(values[key], isListFlag(f))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s: %w", filename, key, err)
+		}
+		if explicit[key] {
+			continue
+		}
+		if env, ok := envFlags[key]; ok {
+			if _, set := os.LookupEnv(env); set {
+				continue
+			}
+		}
+		for _, v := range list {
+			if err := fs.Set(key, v); err != nil {
+				return nil, fmt.Errorf("%s: %s: %w", filename, key, err)
+			}
+		}
+	}
+	return roots, nil
+}
+
+// isListFlag 判断参数是否可以重复指定，每次指定追加一项
+func isListFlag(f *flag.Flag) bool {
+	switch f.Value.(type) {
+	case *stringList, *sizeRules:
+		return true
+	}
+	return false
+}
+
+// configStrings 把配置文件中的一个值转换为参数字符串，allowList 为 true 时还接受数组
+func configStrings(value interface{}, allowList bool) ([]string, error) {
+	if items, ok := value.([]interface{}); ok {
+		if !allowList {
+			return nil, fmt.Errorf("takes a single value, not a list")
+		}
+		var list []string
+		for _, item := range items {
+			s, err := configString(item)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, s)
+		}
+		return list, nil
+	}
+	s, err := configString(value)
+	if err != nil {
+		return nil, err
+	}
+	return []string{s}, nil
+}
+
+func configString(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case json.Number:
+		return v.String(), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	}
+	return "", fmt.Errorf("unsupported value %v, want a string, number or boolean", value)
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+)
+
+// scanError 是扫描过程中记录下来的一条错误
+type scanError struct {
+	Category string // 错误类别，例如 lstat、stat、store、walk
+	Path     string
+	Err      error
+	Fatal    bool // 严重错误会让程序以非零状态退出
+}
+
+func (e scanError) String() string {
+	if e.Path == "" {
+		return fmt.Sprintf("[%s] %s", e.Category, e.Err)
+	}
+	return fmt.Sprintf("[%s] %s: %s", e.Category, e.Path, e.Err)
+}
+
+// errorCollector 线程安全地收集错误，扫描结束后统一输出，避免和进度信息混在一起
+type errorCollector struct {
+	mu     sync.Mutex
+	errors []scanError
+}
+
+var scanErrors errorCollector
+
+// reset 清空已经记录的错误，-watch 的每一轮扫描单独报告错误
+func (c *errorCollector) reset() {
+	c.mu.Lock()
+	c.errors = nil
+	c.mu.Unlock()
+}
+
+// add 记录一条普通错误，扫描会继续进行
+func (c *errorCollector) add(category, path string, err error) {
+	c.record(scanError{Category: category, Path: path, Err: err})
+}
+
+// addFatal 记录一条严重错误
+func (c *errorCollector) addFatal(category, path string, err error) {
+	c.record(scanError{Category: category, Path: path, Err: err, Fatal: true})
+}
+
+// record 保存一条错误；-log-json 时错误不等到结束才汇总，而是立即作为 "error" 事件输出
+func (c *errorCollector) record(e scanError) {
+	c.mu.Lock()
+	c.errors = append(c.errors, e)
+	c.mu.Unlock()
+	diagEvent(levelQuiet, "error", map[string]interface{}{
+		"category": e.Category, "path": e.Path, "error": e.Err.Error(), "fatal": e.Fatal,
+	})
+}
+
+func (c *errorCollector) count() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.errors)
+}
+
+// hasCategory 判断是否记录过某个类别的错误
+func (c *errorCollector) hasCategory(category string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, e := range c.errors {
+		if e.Category == category {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *errorCollector) hasFatal() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, e := range c.errors {
+		if e.Fatal {
+			return true
+		}
+	}
+	return false
+}
+
+// printSummary 输出按类别统计的错误数量以及前 maxMessages 条错误
+func (c *errorCollector) printSummary(w io.Writer, maxMessages int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.errors) == 0 {
+		return
+	}
+
+	counts := make(map[string]int)
+	for _, e := range c.errors {
+		counts[e.Category]++
+	}
+	var categories []string
+	for category := range counts {
+		categories = append(categories, category)
+	}
+	sort.Strings(categories)
+
+	fmt.Fprintf(w, "Errors: %d in total\n", len(c.errors))
+	for _, category := range categories {
+		fmt.Fprintf(w, "  %s: %d\n", category, counts[category])
+	}
+	if maxMessages > len(c.errors) {
+		maxMessages = len(c.errors)
+	}
+	fmt.Fprintf(w, "First %d errors:\n", maxMessages)
+	for _, e := range c.errors[:maxMessages] {
+		fmt.Fprintf(w, "  %s\n", e)
+	}
+}
+
+// saveToFile 把所有错误的完整信息写入文件，每行一条
+func (c *errorCollector) saveToFile(filename string) error {
+	file, err := createOutputFile(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, e := range c.errors {
+		fmt.Fprintln(file, e)
+	}
+	return file.commit()
+}
+
+// reportErrors 在程序结束时输出错误汇总，writeFile 为 true 时把完整信息写入输出目录中的 fav.log.errors，
+// 有严重错误时返回 1 作为退出码
+func reportErrors(writeFile bool) int {
+	if scanErrors.count() == 0 {
+		return 0
+	}
+
+	if !jsonLogFlag {
+		scanErrors.printSummary(diagOutput, 10)
+	}
+	if writeFile {
+		if err := scanErrors.saveToFile("fav.log.errors"); err != nil {
+			errorf("Error saving to fav.log.errors: %s\n", err)
+		} else {
+			infof("Saved error details to %s\n", outputPath("fav.log.errors"))
+		}
+	}
+	if scanErrors.hasFatal() {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,19 @@
+//go:build !windows
+
+package scanner
+
+import (
+	"os"
+	"syscall"
+)
+
+// AllocatedSize 返回文件实际占用的磁盘空间（已分配的 512 字节块数乘以 512）。
+// 稀疏文件（例如虚拟机镜像）占用的空间可能远小于它的大小，小文件则会被向上取整到整块；
+// 不是本地 stat 得到的 info（例如 sftp 条目）返回逻辑大小
+func AllocatedSize(info os.FileInfo) int64 {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return info.Size()
+	}
+	return int64(st.Blocks) * 512
+}
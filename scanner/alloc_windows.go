@@ -0,0 +1,10 @@
+//go:build windows
+
+package scanner
+
+import "os"
+
+// AllocatedSize 返回文件占用的磁盘空间；Windows 上 os.FileInfo 不提供分配的块数，返回逻辑大小
+func AllocatedSize(info os.FileInfo) int64 {
+	return info.Size()
+}
@@ -0,0 +1,162 @@
+package scanner
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// archiveSeparator 分隔压缩包的路径和其中条目的路径，例如 "backup.zip!/photos/a.jpg"
+const archiveSeparator = "!/"
+
+// archiveKind 根据文件名判断 ScanArchives 支持的压缩包格式，不支持时返回空字符串
+func archiveKind(name string) string {
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(lower, ".zip"):
+		return "zip"
+	case strings.HasSuffix(lower, ".tar"):
+		return "tar"
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		return "tgz"
+	}
+	return ""
+}
+
+// SplitArchivePath 把压缩包中条目的路径拆成压缩包的路径和条目在包内的路径，
+// 不是压缩包中的条目时返回 ok == false
+func SplitArchivePath(p string) (archive, entry string, ok bool) {
+	for i := 0; ; {
+		j := strings.Index(p[i:], archiveSeparator)
+		if j < 0 {
+			return "", "", false
+		}
+		i += j
+		if archiveKind(p[:i]) != "" {
+			return p[:i], p[i+len(archiveSeparator):], true
+		}
+		i += len(archiveSeparator)
+	}
+}
+
+// IsArchiveEntry 判断 p 是否是 ScanArchives 返回的压缩包中的条目，这样的路径在本地并不存在
+func IsArchiveEntry(p string) bool {
+	_, _, ok := SplitArchivePath(p)
+	return ok
+}
+
+// isArchive 判断是否要打开这个本地文件列出其中的条目
+func (s *scanner) isArchive(p string) bool {
+	return s.opts.ScanArchives && !IsRemote(p) && archiveKind(p) != ""
+}
+
+// processArchive 不解压地读取压缩包的目录，把其中每个普通文件作为 "压缩包!/包内路径" 返回，
+// 大小和修改时间取自压缩包中的记录。包内的条目同样经过排除规则、SkipHidden、大小阈值、Include 和 ExcludeExts 过滤，
+// 排除规则相对于压缩包所在的根目录 root 匹配；压缩包中的压缩包不会再展开。与普通文件一样，取消后已经开始读取的压缩包仍会读完，DirDone 报告的目录中不会漏掉条目；
+// 打不开或读到一半出错的压缩包只报告错误，已经返回的条目保留
+func (s *scanner) processArchive(root, p string) {
+	var err error
+	switch archiveKind(p) {
+	case "zip":
+		err = s.readZip(root, p)
+	default:
+		err = s.readTar(root, p)
+	}
+	if err != nil {
+		s.report("archive", p, err, false)
+	}
+}
+
+func (s *scanner) readZip(root, p string) error {
+	r, err := zip.OpenReader(p)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	for _, f := range r.File {
+		info := f.FileInfo()
+		if info.Mode().IsRegular() {
+			s.archiveEntry(root, p, f.Name, info.Size(), info.ModTime())
+		}
+	}
+	return nil
+}
+
+// readTar 依次读取 tar 的每个头部，跳过文件内容；.tar.gz 需要解压整个流才能找到所有头部
+func (s *scanner) readTar(root, p string) error {
+	file, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var r io.Reader = file
+	if archiveKind(p) == "tgz" {
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		r = gz
+	}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if hdr.FileInfo().Mode().IsRegular() {
+			s.archiveEntry(root, p, hdr.Name, hdr.Size, hdr.ModTime)
+		}
+	}
+}
+
+// archiveEntry 过滤并返回压缩包中的一个条目。包内路径统一为不以 "/" 开头、不含 ".." 的形式
+func (s *scanner) archiveEntry(root, archive, name string, size int64, modTime time.Time) {
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
+	if name == "" {
+		return
+	}
+	p := archive + archiveSeparator + name
+	if s.opts.Scanned != nil {
+		atomic.AddInt64(s.opts.Scanned, 1)
+	}
+	if s.archiveEntryExcluded(root, archive, name) {
+		return
+	}
+	if hasExtension(p, s.excludeExts) || (len(s.includeRegexps) > 0 && !matchesAny(p, s.includeRegexps)) {
+		return
+	}
+	if !s.sizeInRange(p, size) {
+		return
+	}
+	s.out <- FileInfo{Path: p, Size: size, ModTime: modTime}
+}
+
+// archiveEntryExcluded 像遍历目录一样检查包内路径的每一级：任意一级被排除规则排除，
+// 或者开启 SkipHidden 时任意一级以 "." 开头，这个条目都不返回
+func (s *scanner) archiveEntryExcluded(root, archive, name string) bool {
+	p := archive + archiveSeparator
+	for i, part := range strings.Split(name, "/") {
+		if s.opts.SkipHidden && strings.HasPrefix(part, ".") {
+			return true
+		}
+		if i > 0 {
+			p += "/"
+		}
+		p += part
+		if isExcluded(root, p, s.excludeRules) {
+			return true
+		}
+	}
+	return false
+}
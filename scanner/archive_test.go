@@ -0,0 +1,118 @@
+package scanner
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// archiveFixture 是写入测试压缩包的条目和它们的大小
+var archiveFixture = map[string]int{
+	"film.mkv":              100,
+	"photos/a.jpg":          100,
+	"web/node_modules/x.js": 100,
+	"tmp/scratch.tmp":       100,
+	".git/objects/blob":     100,
+	"photos/.thumb.jpg":     100,
+	"Cache/blob":            100,
+}
+
+func writeZip(t *testing.T, p string) {
+	t.Helper()
+	file, err := os.Create(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	w := zip.NewWriter(file)
+	for name, size := range archiveFixture {
+		f, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.Write(make([]byte, size)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeTgz(t *testing.T, p string) {
+	t.Helper()
+	file, err := os.Create(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	gz := gzip.NewWriter(file)
+	w := tar.NewWriter(gz)
+	for name, size := range archiveFixture {
+		if err := w.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(size), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write(make([]byte, size)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestScanArchiveEntriesFiltered 检查压缩包中的条目与目录中的文件一样被排除规则和 SkipHidden 过滤
+func TestScanArchiveEntriesFiltered(t *testing.T) {
+	dir := t.TempDir()
+	writeZip(t, filepath.Join(dir, "backup.zip"))
+	writeTgz(t, filepath.Join(dir, "backup.tgz"))
+
+	tests := []struct {
+		name string
+		opts Options
+		want []string
+	}{
+		{"no filters", Options{}, []string{
+			"film.mkv", "photos/a.jpg", "web/node_modules/x.js", "tmp/scratch.tmp",
+			".git/objects/blob", "photos/.thumb.jpg", "Cache/blob",
+		}},
+		{"excludes", Options{Exclude: []string{"node_modules", "*.tmp", "*/Cache/*"}}, []string{
+			"film.mkv", "photos/a.jpg", ".git/objects/blob", "photos/.thumb.jpg",
+		}},
+		{"exclude ignore case", Options{Exclude: []string{"cache"}, ExcludeIgnoreCase: true}, []string{
+			"film.mkv", "photos/a.jpg", "web/node_modules/x.js", "tmp/scratch.tmp", ".git/objects/blob", "photos/.thumb.jpg",
+		}},
+		{"skip hidden", Options{SkipHidden: true}, []string{
+			"film.mkv", "photos/a.jpg", "web/node_modules/x.js", "tmp/scratch.tmp", "Cache/blob",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := tt.opts
+			opts.Roots = []string{dir}
+			opts.MaxDepth = -1
+			opts.MinSize = 100
+			opts.ScanArchives = true
+			found := collect(t, opts)
+			want := make(map[string]int64)
+			for _, archive := range []string{"backup.zip", "backup.tgz"} {
+				// 压缩包本身也作为普通文件返回
+				info, err := os.Stat(filepath.Join(dir, archive))
+				if err != nil {
+					t.Fatal(err)
+				}
+				want[archive] = info.Size()
+				for _, name := range tt.want {
+					want[archive+archiveSeparator+name] = 100
+				}
+			}
+			assertPaths(t, dir, found, want)
+		})
+	}
+}
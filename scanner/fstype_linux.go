@@ -0,0 +1,71 @@
+//go:build linux
+
+package scanner
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// mountsFile 列出当前进程可见的所有挂载点，每行为 "设备 挂载点 类型 选项 0 0"
+const mountsFile = "/proc/self/mounts"
+
+// skippedDevices 读取挂载表，返回类型在 fsTypes 中的挂载点所在设备的 ID 到文件系统类型的映射。
+// 挂载点已经无法访问（例如失去响应的 NFS）时 stat 会失败，这样的挂载点被忽略
+func skippedDevices(fsTypes []string) (map[uint64]string, error) {
+	skip := make(map[string]bool, len(fsTypes))
+	for _, t := range fsTypes {
+		skip[t] = true
+	}
+	file, err := os.Open(mountsFile)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	devs := make(map[uint64]string)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 || !skip[fields[2]] {
+			continue
+		}
+		var st syscall.Stat_t
+		if err := syscall.Stat(unescapeMountPath(fields[1]), &st); err != nil {
+			continue
+		}
+		devs[uint64(st.Dev)] = fields[2]
+	}
+	return devs, scanner.Err()
+}
+
+// unescapeMountPath 还原挂载表中转义成 "\040" 这类八进制形式的空格、制表符、换行和反斜杠
+func unescapeMountPath(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+4 <= len(s) {
+			if c, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(c))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// deviceID 返回条目所在设备的 ID，不是本地 stat 得到的 info（例如 sftp 条目）返回 ok == false
+func deviceID(info os.FileInfo) (dev uint64, ok bool) {
+	st, isStat := info.Sys().(*syscall.Stat_t)
+	if !isStat {
+		return 0, false
+	}
+	return uint64(st.Dev), true
+}
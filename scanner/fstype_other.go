@@ -0,0 +1,17 @@
+//go:build !linux
+
+package scanner
+
+import "os"
+
+// mountsFile 只用于报告错误，这些平台上不会读取它
+const mountsFile = "/proc/self/mounts"
+
+// skippedDevices 在没有 /proc/mounts 的平台上无法判断文件系统类型，SkipFSTypes 不起作用
+func skippedDevices(fsTypes []string) (map[uint64]string, error) {
+	return nil, nil
+}
+
+func deviceID(info os.FileInfo) (dev uint64, ok bool) {
+	return 0, false
+}
@@ -0,0 +1,23 @@
+//go:build !windows
+
+package scanner
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileID 标识一个 inode，硬链接到同一个文件的不同路径有相同的 fileID
+type fileID struct {
+	dev uint64
+	ino uint64
+}
+
+// hardlinkID 返回有多个硬链接的普通文件的 fileID，其他文件返回 ok == false
+func hardlinkID(info os.FileInfo) (id fileID, ok bool) {
+	st, isStat := info.Sys().(*syscall.Stat_t)
+	if !isStat || !info.Mode().IsRegular() || st.Nlink < 2 {
+		return fileID{}, false
+	}
+	return fileID{dev: uint64(st.Dev), ino: uint64(st.Ino)}, true
+}
@@ -0,0 +1,12 @@
+//go:build windows
+
+package scanner
+
+import "os"
+
+// fileID 标识一个 inode；Windows 上 os.FileInfo 不提供 inode，硬链接不会被识别
+type fileID struct{}
+
+func hardlinkID(info os.FileInfo) (id fileID, ok bool) {
+	return fileID{}, false
+}
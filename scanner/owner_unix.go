@@ -0,0 +1,17 @@
+//go:build !windows
+
+package scanner
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileOwner 从 Lstat 的结果中取出所有者和权限位，文件信息中没有 syscall.Stat_t（例如远程文件）时返回 nil
+func fileOwner(info os.FileInfo) *Owner {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil
+	}
+	return &Owner{UID: st.Uid, GID: st.Gid, Mode: info.Mode() & (os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky)}
+}
@@ -0,0 +1,10 @@
+//go:build windows
+
+package scanner
+
+import "os"
+
+// fileOwner 在 Windows 上总是返回 nil，os.FileInfo 不提供 UID 和 GID
+func fileOwner(info os.FileInfo) *Owner {
+	return nil
+}
@@ -0,0 +1,174 @@
+package scanner
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// globToRegexp 把通配符模式转换为锚定的正则表达式：模式需要匹配完整路径，
+// "*" 匹配任意字符（包括 "/"），"?" 匹配单个字符，其余字符按字面意义匹配；ignoreCase 为 true 时不区分大小写
+func globToRegexp(pattern string, ignoreCase bool) (*regexp.Regexp, error) {
+	quoted := regexp.QuoteMeta(pattern)
+	quoted = strings.ReplaceAll(quoted, `\*`, ".*")
+	quoted = strings.ReplaceAll(quoted, `\?`, ".")
+	if ignoreCase {
+		quoted = "(?i)" + quoted
+	}
+	return regexp.Compile("^" + quoted + "$")
+}
+
+// compileGlobs 把一组通配符模式编译为正则表达式
+func compileGlobs(patterns []string) ([]*regexp.Regexp, error) {
+	res := make([]*regexp.Regexp, len(patterns))
+	for i, pattern := range patterns {
+		re, err := globToRegexp(pattern, false)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern '%s': %w", pattern, err)
+		}
+		res[i] = re
+	}
+	return res, nil
+}
+
+// matchesAny 判断路径是否匹配其中任意一个模式
+func matchesAny(path string, res []*regexp.Regexp) bool {
+	for _, re := range res {
+		if re.MatchString(path) {
+			return true
+		}
+	}
+	return false
+}
+
+// compileExcludes 编译排除模式，规则与根目录中的 .scanignore 相同：没有 "/" 的模式匹配文件名，
+// 例如 "node_modules"、"*.tmp"；其他模式匹配相对于根目录的路径，例如 "cache/*"、"*/node_modules/*"。
+// ignoreCase 为 true 时不区分大小写，"Cache" 也会排除 "cache" 目录
+func compileExcludes(patterns []string, ignoreCase bool) ([]ignoreRule, error) {
+	return compileIgnoreRules(patterns, ignoreCase)
+}
+
+// isExcluded 判断根目录 root 之下的 path 是否被任意一个排除规则排除。
+// 匹配的是相对于 root 的路径，所以结果与根目录写成 "." 还是绝对路径无关
+func isExcluded(root, path string, rules []ignoreRule) bool {
+	if len(rules) == 0 {
+		return false
+	}
+	frame := ignoreFrame{dir: filepath.Clean(root), rules: rules}
+	return frame.ignores(path)
+}
+
+// compileExcludePaths 按所在目录把 ExcludePaths 分组，遍历时只需要比较同一目录下的文件名
+func compileExcludePaths(paths []string) (map[string][]string, error) {
+	byDir := make(map[string][]string)
+	for _, p := range paths {
+		p = filepath.Clean(p)
+		base := filepath.Base(p)
+		if _, err := filepath.Match(base, ""); err != nil {
+			return nil, fmt.Errorf("%q: %w", p, err)
+		}
+		dir := filepath.Dir(p)
+		byDir[dir] = append(byDir[dir], base)
+	}
+	return byDir, nil
+}
+
+// matchesExcludePath 判断路径是否是 compileExcludePaths 分组后的某个要排除的路径
+func matchesExcludePath(path string, byDir map[string][]string) bool {
+	if len(byDir) == 0 {
+		return false
+	}
+	path = filepath.Clean(path)
+	for _, pattern := range byDir[filepath.Dir(path)] {
+		if ok, _ := filepath.Match(pattern, filepath.Base(path)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// parseExtensions 把扩展名列表（如 "iso"、".tmp"）转换为小写、不带点的集合
+func parseExtensions(list []string) map[string]bool {
+	exts := make(map[string]bool)
+	for _, ext := range list {
+		ext = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(ext), "."))
+		if ext != "" {
+			exts[ext] = true
+		}
+	}
+	return exts
+}
+
+// hasExtension 判断路径的扩展名是否在集合中，不区分大小写
+func hasExtension(path string, exts map[string]bool) bool {
+	ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(path), "."))
+	return ext != "" && exts[ext]
+}
+
+// LoadPatterns 读取模式文件，每行一个模式
+func LoadPatterns(filename string) ([]string, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var patterns []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		patterns = append(patterns, scanner.Text())
+	}
+	return patterns, scanner.Err()
+}
+
+// ignoreRule 是 .scanignore 中的一条规则。没有 "/" 的模式匹配文件名本身，
+// 其他模式匹配相对于 .scanignore 所在目录的路径，开头的 "/" 会被去掉
+type ignoreRule struct {
+	re       *regexp.Regexp
+	baseName bool
+}
+
+// ignoreFrame 是一个目录中 .scanignore 的全部规则，只作用于该目录之下的条目
+type ignoreFrame struct {
+	dir   string
+	rules []ignoreRule
+}
+
+// compileIgnoreRules 编译 .scanignore 中的模式，忽略空行和以 "#" 开头的注释，ignoreCase 为 true 时不区分大小写
+func compileIgnoreRules(patterns []string, ignoreCase bool) ([]ignoreRule, error) {
+	var rules []ignoreRule
+	for _, pattern := range patterns {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" || strings.HasPrefix(pattern, "#") {
+			continue
+		}
+		baseName := !strings.Contains(pattern, "/")
+		re, err := globToRegexp(strings.TrimPrefix(pattern, "/"), ignoreCase)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern '%s': %w", pattern, err)
+		}
+		rules = append(rules, ignoreRule{re: re, baseName: baseName})
+	}
+	return rules, nil
+}
+
+// ignores 判断 path 是否被这个目录的规则忽略
+func (f *ignoreFrame) ignores(path string) bool {
+	rel, err := filepath.Rel(f.dir, path)
+	if err != nil {
+		return false
+	}
+	rel = filepath.ToSlash(rel)
+	for _, rule := range f.rules {
+		if rule.baseName && rule.re.MatchString(filepath.Base(path)) {
+			return true
+		}
+		if !rule.baseName && rule.re.MatchString(rel) {
+			return true
+		}
+	}
+	return false
+}
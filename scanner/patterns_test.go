@@ -0,0 +1,167 @@
+package scanner
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestIsExcluded(t *testing.T) {
+	root := filepath.FromSlash("/data")
+	tests := []struct {
+		name     string
+		patterns []string
+		path     string
+		want     bool
+	}{
+		{"wildcard name", []string{"*.tmp"}, "/data/a.tmp", true},
+		{"wildcard name nested", []string{"*.tmp"}, "/data/x/y/a.tmp", true},
+		{"wildcard name no match", []string{"*.tmp"}, "/data/a.tmpx", false},
+		{"exact name", []string{"node_modules"}, "/data/web/node_modules", true},
+		{"exact name is not a substring match", []string{"node_modules"}, "/data/web/node_modules2", false},
+		{"question mark", []string{"a?.log"}, "/data/ab.log", true},
+		{"question mark is one character", []string{"a?.log"}, "/data/abc.log", false},
+		{"relative path", []string{"cache/*"}, "/data/cache/a.bin", true},
+		{"relative path matches from the root only", []string{"cache/*"}, "/data/x/cache/a.bin", false},
+		{"star crosses slashes", []string{"cache/*"}, "/data/cache/x/y.bin", true},
+		{"nested directory", []string{"*/node_modules/*"}, "/data/web/node_modules/lib.js", true},
+		{"nested directory needs a parent", []string{"*/node_modules/*"}, "/data/node_modules/lib.js", false},
+		{"leading slash is anchored at the root", []string{"/build"}, "/data/build", true},
+		{"leading slash does not match deeper", []string{"/build"}, "/data/src/build", false},
+		{"comments and blank lines ignored", []string{"# *.mkv", "", "*.iso"}, "/data/a.mkv", false},
+		{"any of several patterns", []string{"*.iso", "*.mkv"}, "/data/a.mkv", true},
+		{"case sensitive by default", []string{"*.MKV"}, "/data/a.mkv", false},
+		{"regex metacharacters are literal", []string{"a+b.txt"}, "/data/aab.txt", false},
+		{"no patterns", nil, "/data/a.tmp", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules, err := compileExcludes(tt.patterns, false)
+			if err != nil {
+				t.Fatalf("compileExcludes(%q): %v", tt.patterns, err)
+			}
+			if got := isExcluded(root, filepath.FromSlash(tt.path), rules); got != tt.want {
+				t.Errorf("isExcluded(%q, %q) with %q = %v, want %v", root, tt.path, tt.patterns, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsExcludedRelativeRoot(t *testing.T) {
+	rules, err := compileExcludes([]string{"cache/*"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 根目录写成 "." 时遍历得到的路径没有 "./" 前缀，匹配结果与绝对路径的根目录相同
+	for _, tt := range []struct {
+		root, path string
+		want       bool
+	}{
+		{".", "cache/a.bin", true},
+		{".", "src/cache/a.bin", false},
+		{"data", "data/cache/a.bin", true},
+		{"data/", "data/cache/a.bin", true},
+	} {
+		if got := isExcluded(tt.root, filepath.FromSlash(tt.path), rules); got != tt.want {
+			t.Errorf("isExcluded(%q, %q) = %v, want %v", tt.root, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestCompileExcludesMetacharacters(t *testing.T) {
+	// QuoteMeta 转义了所有元字符，任何模式都能编译
+	if _, err := compileExcludes([]string{"[", "(", "a\\b"}, false); err != nil {
+		t.Errorf("compileExcludes: %v", err)
+	}
+}
+
+func TestGlobToRegexp(t *testing.T) {
+	tests := []struct {
+		pattern, path string
+		want          bool
+	}{
+		// "." 是字面意义的点
+		{"a.mkv", "a.mkv", true},
+		{"a.mkv", "axmkv", false},
+		// 括号、加号等元字符按字面意义匹配
+		{"film (2020).mkv", "film (2020).mkv", true},
+		{"film (2020).mkv", "film 2020.mkv", false},
+		{"a+b[1].txt", "a+b[1].txt", true},
+		{"a+b[1].txt", "aab1.txt", false},
+		{"^a$|b", "^a$|b", true},
+		{"^a$|b", "b", false},
+		// 模式要匹配完整路径，不是子串
+		{"temp", "temp", true},
+		{"temp", "mytemp", false},
+		{"temp", "temporary", false},
+		{"temp", "a/temp/b", false},
+		// "*" 在开头、结尾和中间
+		{"*.tmp", "a.tmp", true},
+		{"*.tmp", "dir/a.tmp", true},
+		{"*.tmp", "a.tmp.bak", false},
+		{"cache*", "cache", true},
+		{"cache*", "cache/a/b", true},
+		{"cache*", "mycache", false},
+		{"a*z", "az", true},
+		{"a*z", "a/b/z", true},
+		{"a*z", "a/b/zz/y", false},
+		{"*cache*", "x/cache/y", true},
+		// "?" 正好匹配一个字符
+		{"a?c", "abc", true},
+		{"a?c", "ac", false},
+		{"a?c", "abbc", false},
+	}
+	for _, tt := range tests {
+		re, err := globToRegexp(tt.pattern, false)
+		if err != nil {
+			t.Fatalf("globToRegexp(%q): %v", tt.pattern, err)
+		}
+		if got := re.MatchString(tt.path); got != tt.want {
+			t.Errorf("globToRegexp(%q) = %s, match %q = %v, want %v", tt.pattern, re, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestIsExcludedIgnoreCase(t *testing.T) {
+	root := filepath.FromSlash("/data")
+	tests := []struct {
+		patterns []string
+		path     string
+	}{
+		{[]string{"Cache"}, "/data/cache"},
+		{[]string{"cache"}, "/data/web/CACHE"},
+		{[]string{"*.MKV"}, "/data/Film.mkv"},
+		{[]string{"*.mkv"}, "/data/film.MkV"},
+		{[]string{"Cache/*"}, "/data/cache/Blob.bin"},
+		{[]string{"*/Node_Modules/*"}, "/data/web/node_modules/lib.js"},
+		{[]string{"/Build"}, "/data/build"},
+	}
+	for _, tt := range tests {
+		sensitive, err := compileExcludes(tt.patterns, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		insensitive, err := compileExcludes(tt.patterns, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.FromSlash(tt.path)
+		// 默认区分大小写
+		if isExcluded(root, path, sensitive) {
+			t.Errorf("%q excluded %q by default, want case-sensitive matching", tt.patterns, tt.path)
+		}
+		if !isExcluded(root, path, insensitive) {
+			t.Errorf("%q with ignoreCase did not exclude %q", tt.patterns, tt.path)
+		}
+	}
+}
+
+// TestScanExcludeIgnoreCase 检查 ExcludeIgnoreCase 默认关闭，打开后大小写不同的目录和文件也被排除
+func TestScanExcludeIgnoreCase(t *testing.T) {
+	root := filepath.FromSlash("/data")
+	tree := newMemTree(root, "Cache/blob=10", "cache/blob=10", "Film.MKV=10", "film.mkv=10", "keep.bin=10")
+	opts := Options{Roots: []string{root}, Exclude: []string{"cache", "*.mkv"}, MaxDepth: -1, Walker: tree}
+	assertPaths(t, root, collect(t, opts), map[string]int64{"Cache/blob": 10, "Film.MKV": 10, "keep.bin": 10})
+
+	opts.ExcludeIgnoreCase = true
+	assertPaths(t, root, collect(t, opts), map[string]int64{"keep.bin": 10})
+}
@@ -0,0 +1,165 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+	"net"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// remotePrefix 是远程根目录的前缀，例如 "sftp://user@host:2222/data"
+const remotePrefix = "sftp://"
+
+// IsRemote 判断根目录或路径是否是通过 SFTP 访问的远程路径
+func IsRemote(p string) bool {
+	return strings.HasPrefix(p, remotePrefix)
+}
+
+// remoteRoot 是解析后的 sftp://user@host[:port]/path
+type remoteRoot struct {
+	user string
+	addr string // host:port
+	dir  string // 远程主机上的绝对路径
+}
+
+func parseRemoteRoot(root string) (*remoteRoot, error) {
+	u, err := url.Parse(root)
+	if err != nil {
+		return nil, err
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("missing host in %s", root)
+	}
+	r := &remoteRoot{user: u.User.Username(), addr: u.Host, dir: path.Clean("/" + u.Path)}
+	if r.user == "" {
+		r.user = os.Getenv("USER")
+	}
+	if u.Port() == "" {
+		r.addr = net.JoinHostPort(u.Hostname(), "22")
+	}
+	return r, nil
+}
+
+// sftpClient 是登录后的 SFTP 客户端，Close 时一起关闭 SSH 连接和登录用的 ssh-agent 连接；
+// sftp.Client 的 Close 只关闭 SFTP 会话
+type sftpClient struct {
+	*sftp.Client
+	conn      *ssh.Client
+	agentConn net.Conn // 没有使用 ssh-agent 时为 nil
+}
+
+func (c *sftpClient) Close() error {
+	err := c.Client.Close()
+	c.conn.Close()
+	if c.agentConn != nil {
+		c.agentConn.Close()
+	}
+	return err
+}
+
+// dialSFTP 用 ssh-agent 和 ~/.ssh 下的私钥登录，主机密钥按 ~/.ssh/known_hosts 校验
+func dialSFTP(r *remoteRoot) (*sftpClient, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, err
+	}
+	hostKeys, err := knownhosts.New(filepath.Join(home, ".ssh", "known_hosts"))
+	if err != nil {
+		return nil, fmt.Errorf("reading known_hosts: %w", err)
+	}
+
+	var auth []ssh.AuthMethod
+	var agentConn net.Conn
+	if sock := os.Getenv("SSH_AUTH_SOCK"); sock != "" {
+		if agentConn, err = net.Dial("unix", sock); err == nil {
+			auth = append(auth, ssh.PublicKeysCallback(agent.NewClient(agentConn).Signers))
+		}
+	}
+	closeAgent := func() {
+		if agentConn != nil {
+			agentConn.Close()
+		}
+	}
+	var signers []ssh.Signer
+	for _, name := range []string{"id_ed25519", "id_ecdsa", "id_rsa"} {
+		key, err := os.ReadFile(filepath.Join(home, ".ssh", name))
+		if err != nil {
+			continue
+		}
+		if signer, err := ssh.ParsePrivateKey(key); err == nil {
+			signers = append(signers, signer)
+		}
+	}
+	if len(signers) > 0 {
+		auth = append(auth, ssh.PublicKeys(signers...))
+	}
+	if len(auth) == 0 {
+		return nil, errors.New("no ssh-agent or unencrypted key in ~/.ssh to log in with")
+	}
+
+	conn, err := ssh.Dial("tcp", r.addr, &ssh.ClientConfig{User: r.user, Auth: auth, HostKeyCallback: hostKeys})
+	if err != nil {
+		closeAgent()
+		return nil, err
+	}
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		conn.Close()
+		closeAgent()
+		return nil, err
+	}
+	return &sftpClient{Client: client, conn: conn, agentConn: agentConn}, nil
+}
+
+// walkRemote 通过 SFTP 遍历远程根目录，过滤规则与本地遍历相同。
+// 返回给调用者的路径是 root 加上相对路径，例如 "sftp://host/data/a.iso"；
+// 远程遍历不读取 IgnoreFile，也不跟随软链接，只返回普通文件
+func (s *scanner) walkRemote(ctx context.Context, taskQueue chan<- Task, root string) error {
+	r, err := parseRemoteRoot(root)
+	if err != nil {
+		return err
+	}
+	client, err := dialSFTP(r)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	base := strings.TrimSuffix(root, "/")
+	walker := client.Walk(r.dir)
+	for walker.Step() {
+		rel := strings.TrimPrefix(strings.TrimPrefix(walker.Path(), r.dir), "/")
+		p := base
+		if rel != "" {
+			p = base + "/" + rel
+		}
+		if err := walker.Err(); err != nil {
+			// 根目录本身读不了时整个根目录的遍历失败，其他条目只跳过
+			if rel == "" {
+				return err
+			}
+			s.skip("walk", p, err)
+			continue
+		}
+		err := s.visit(ctx, taskQueue, root, p, walker.Stat())
+		if err == filepath.SkipDir {
+			if walker.Stat().IsDir() {
+				walker.SkipDir()
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
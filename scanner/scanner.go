@@ -0,0 +1,498 @@
+// Package scanner 遍历目录树，找出达到大小阈值的文件。
+// 它只负责遍历和过滤，不涉及缓存存储和日志输出，可以嵌入到其他程序中使用。
+package scanner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// FileInfo 是扫描找到的一个文件，跟随软链接时 Path 是目标的真实路径
+type FileInfo struct {
+	Path    string
+	Size    int64
+	ModTime time.Time
+	Owner   *Owner // 只在设置了 CaptureOwner 时有值，平台不支持时为 nil
+}
+
+// Owner 是文件的所有者和权限位，Mode 只包含权限和 setuid、setgid、sticky 位
+type Owner struct {
+	UID  uint32
+	GID  uint32
+	Mode os.FileMode
+}
+
+// Options 控制一次扫描的范围和过滤规则
+type Options struct {
+	Roots           []string // 要遍历的根目录，依次遍历
+	MinSize         int64    // 只返回不小于 MinSize 字节的文件
+	MaxSize         int64    // 只返回不大于 MaxSize 字节的文件，<= 0 时没有上限
+	Exclude         []string // 通配符排除模式，没有 "/" 的匹配文件名，其他的匹配相对于根目录的路径，"*" 可以跨越 "/"
+	ExcludePaths    []string // 要排除的具体路径，最后一段可以含通配符，与遍历得到的路径（根目录加相对路径）比较，例如扫描自己写出的日志
+	Include         []string // 非空时只返回匹配其中任意一个模式的文件，排除模式优先
+	ExcludeExts     []string // 跳过这些扩展名的文件，不区分大小写，可带或不带 "."
+	SkipHidden      bool     // 跳过名字以 "." 开头的文件和目录，根目录本身除外
+	MaxDepth        int      // 根目录的直接子项深度为 0，不进入深度达到 MaxDepth 的目录；负数不限制
+	FollowSymlinks  bool     // 解析指向文件的软链接，按目标的真实路径返回，每个目标只返回一次
+	DedupeHardlinks bool     // 同一个 inode 的多个硬链接只返回最先遇到的路径
+	IgnoreFile      string   // 每个目录中这个名字的文件（如 ".scanignore"）列出的模式只作用于该目录之下，为空时不读取
+	Workers         int      // 并发执行 stat 的 worker 数，<= 0 时使用 CPU 数
+	Walker          Walker   // 遍历本地根目录的实现，为 nil 时使用 godirwalk；sftp:// 根目录不使用它
+
+	// ExcludeIgnoreCase 为 true 时 Exclude 中的模式不区分大小写，适合 macOS、Windows 这类不区分大小写的文件系统；
+	// IgnoreFile 中的模式不受影响
+	ExcludeIgnoreCase bool
+
+	// ExtMinSize 按扩展名（小写、不带点）覆盖 MinSize，例如 .log 文件 10M 以上就返回、视频 1G 以上才返回；
+	// 没有规则的扩展名使用 MinSize
+	ExtMinSize map[string]int64
+
+	// CaptureOwner 为 true 时返回的 FileInfo 带有文件的 UID、GID 和权限位，取自判断大小时的同一次 stat
+	CaptureOwner bool
+
+	// SkipFSTypes 列出要跳过的文件系统类型（与 /proc/mounts 中的写法相同，例如 "nfs4"、"tmpfs"），
+	// 这些类型的挂载点整个不进入；只在 Linux 上有效，其他平台忽略
+	SkipFSTypes []string
+
+	// AllocatedSize 为 true 时用文件实际占用的磁盘空间（见 AllocatedSize）代替逻辑大小，
+	// 大小阈值按它判断，返回的 FileInfo.Size 也是它
+	AllocatedSize bool
+
+	// ScanArchives 为 true 时打开本地的 .zip、.tar、.tar.gz 和 .tgz 文件，不解压地列出其中的文件，
+	// 以 "压缩包!/包内路径" 的形式返回（见 SplitArchivePath），大小和修改时间取自压缩包中的记录
+	ScanArchives bool
+
+	// Visit 在每个没有被过滤掉的条目 Lstat 之后、大小过滤之前调用，可以为 nil；
+	// 它会在遍历的 goroutine 中被调用，不会并发执行
+	Visit func(root, path string, info os.FileInfo)
+	// OnStat 不为 nil 时，遍历中每次 Lstat 之后调用，传入这次调用花费的时间；
+	// 与 Visit 一样在遍历的 goroutine 中调用，为 nil 时不计时
+	OnStat func(path string, elapsed time.Duration)
+	// SkipDir 不为 nil 且返回 true 时不进入该目录，在遍历的 goroutine 中调用
+	SkipDir func(path string) bool
+	// DirDone 不为 nil 时，在一个目录的所有子项都遍历完、其中的文件都已交给工作池后调用；
+	// 这些文件在 channel 关闭前一定会发送出去，即使 ctx 已经取消。因取消而中止的目录不会调用。
+	// 在遍历的 goroutine 中调用
+	DirDone func(path string)
+	// OnError 接收扫描中遇到的错误，可以为 nil，会被多个 worker 并发调用
+	OnError func(err *Error)
+	// Logf 接收逐个条目的调试信息，可以为 nil
+	Logf func(format string, args ...interface{})
+	// Scanned 不为 nil 时，每遍历到一个非目录条目就原子地加一，可用于显示进度
+	Scanned *int64
+	// HardlinksSkipped 不为 nil 时，DedupeHardlinks 每跳过一个重复的硬链接就原子地加一
+	HardlinksSkipped *int64
+	// ErrorsSkipped 不为 nil 时，每因为出错（例如没有权限、路径过长）跳过一个条目就原子地加一
+	ErrorsSkipped *int64
+}
+
+// Error 是扫描中遇到的一个错误。Fatal 为 true 时当前根目录的遍历已经中止
+type Error struct {
+	Category string // 出错的操作，例如 "stat"、"lstat"、"symlink"、"walk"
+	Path     string
+	Err      error
+	Fatal    bool
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s %s: %s", e.Category, e.Path, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+var errScanCancelled = errors.New("scan cancelled")
+
+// scanner 保存一次扫描的状态
+type scanner struct {
+	opts            Options
+	out             chan FileInfo
+	excludeRules    []ignoreRule
+	excludePaths    map[string][]string // Cleaned directory of each ExcludePaths entry -> base name patterns
+	includeRegexps  []*regexp.Regexp
+	excludeExts     map[string]bool
+	rootSet         map[string]bool
+	resolvedTargets sync.Map       // Absolute paths of files already processed while following symlinks
+	seenInodes      sync.Map       // fileIDs of hardlinked files already visited
+	ignoreStack     []*ignoreFrame // .scanignore rules of the directories being walked, innermost last
+
+	skipDevs map[uint64]string // Device IDs of mounts with a SkipFSTypes type -> filesystem type
+}
+
+// Scan 检查参数并在后台开始遍历 opts.Roots，通过返回的 channel 逐个给出达到大小阈值的文件。
+// 遍历结束、所有文件都已给出或 ctx 被取消后 channel 会被关闭；调用者需要一直读取到 channel 关闭。
+// 遍历中遇到的错误交给 opts.OnError，不会让 Scan 返回错误
+func Scan(ctx context.Context, opts Options) (<-chan FileInfo, error) {
+	if len(opts.Roots) == 0 {
+		return nil, errors.New("no root directories")
+	}
+	if opts.Workers <= 0 {
+		opts.Workers = runtime.NumCPU()
+	}
+	s := &scanner{
+		opts:        opts,
+		out:         make(chan FileInfo),
+		excludeExts: parseExtensions(opts.ExcludeExts),
+		rootSet:     make(map[string]bool),
+	}
+	var err error
+	if s.excludeRules, err = compileExcludes(opts.Exclude, opts.ExcludeIgnoreCase); err != nil {
+		return nil, fmt.Errorf("exclude: %w", err)
+	}
+	if s.excludePaths, err = compileExcludePaths(opts.ExcludePaths); err != nil {
+		return nil, fmt.Errorf("exclude path: %w", err)
+	}
+	if s.includeRegexps, err = compileGlobs(opts.Include); err != nil {
+		return nil, fmt.Errorf("include: %w", err)
+	}
+	for _, rootDir := range opts.Roots {
+		s.rootSet[filepath.Clean(rootDir)] = true
+	}
+	if len(opts.SkipFSTypes) > 0 {
+		// 读不到挂载表时只报告错误，照常遍历所有文件系统
+		if s.skipDevs, err = skippedDevices(opts.SkipFSTypes); err != nil {
+			s.report("mounts", mountsFile, err, false)
+		}
+	}
+
+	go s.run(ctx)
+	return s.out, nil
+}
+
+func (s *scanner) logf(format string, args ...interface{}) {
+	if s.opts.Logf != nil {
+		s.opts.Logf(format, args...)
+	}
+}
+
+func (s *scanner) report(category, path string, err error, fatal bool) {
+	if s.opts.OnError != nil {
+		s.opts.OnError(&Error{Category: category, Path: path, Err: err, Fatal: fatal})
+	}
+}
+
+// skip 报告一个非致命错误，并把出错的条目计入 ErrorsSkipped
+func (s *scanner) skip(category, path string, err error) {
+	s.report(category, path, err, false)
+	if s.opts.ErrorsSkipped != nil {
+		atomic.AddInt64(s.opts.ErrorsSkipped, 1)
+	}
+}
+
+// run 依次遍历每个根目录，所有根目录共用同一个工作池
+func (s *scanner) run(ctx context.Context) {
+	defer close(s.out)
+
+	// 初始化工作池
+	taskQueue, poolWg := NewWorkerPool(s.opts.Workers)
+	walker := s.opts.Walker
+	if walker == nil {
+		walker = godirwalkWalker{}
+	}
+	for _, rootDir := range s.opts.Roots {
+		if IsRemote(rootDir) {
+			err := s.walkRemote(ctx, taskQueue, rootDir)
+			if errors.Is(err, errScanCancelled) {
+				break
+			}
+			if err != nil {
+				s.report("walk", rootDir, err, true)
+			}
+			continue
+		}
+		s.ignoreStack = s.ignoreStack[:0]
+		err := walker.Walk(rootDir, WalkCallbacks{
+			Visit: func(osPathname string, de Dirent) error {
+				err := s.visit(ctx, taskQueue, rootDir, osPathname, de)
+				if err == nil && de.IsDir() && s.opts.IgnoreFile != "" {
+					s.pushIgnoreFile(osPathname)
+				}
+				return err
+			},
+			DirDone: func(osPathname string) {
+				s.popIgnoreFile(osPathname)
+				if ctx.Err() == nil && s.opts.DirDone != nil {
+					s.opts.DirDone(osPathname)
+				}
+			},
+			// 读不了的目录或文件只跳过这一个条目，不中止整个根目录的遍历；只有取消会让遍历停下
+			OnError: func(osPathname string, err error) error {
+				if errors.Is(err, errScanCancelled) {
+					return err
+				}
+				s.skip("walk", osPathname, err)
+				return nil
+			},
+		})
+		if errors.Is(err, errScanCancelled) {
+			break
+		}
+		if err != nil {
+			s.report("walk", rootDir, err, true)
+		}
+	}
+
+	// 关闭任务队列，并等待所有已投递的任务完成
+	close(taskQueue)
+	poolWg.Wait()
+}
+
+// visit 是遍历的回调：应用过滤规则，把达到大小阈值的条目交给工作池处理
+func (s *scanner) visit(ctx context.Context, taskQueue chan<- Task, root, osPathname string, de Dirent) error {
+	if ctx.Err() != nil {
+		return errScanCancelled
+	}
+	if !de.IsDir() && s.opts.Scanned != nil {
+		atomic.AddInt64(s.opts.Scanned, 1)
+	}
+	if de.IsDir() && s.opts.SkipDir != nil && s.opts.SkipDir(osPathname) {
+		s.logf("Skipping completed directory: %s\n", osPathname)
+		return filepath.SkipDir
+	}
+
+	isRoot := s.rootSet[filepath.Clean(osPathname)]
+	// 排除模式匹配，根目录本身不会被排除
+	if !isRoot && (isExcluded(root, osPathname, s.excludeRules) || matchesExcludePath(osPathname, s.excludePaths)) {
+		if de.IsDir() {
+			return filepath.SkipDir
+		}
+		return nil
+	}
+	if !de.IsDir() && hasExtension(osPathname, s.excludeExts) {
+		return nil
+	}
+	// .scanignore 忽略的目录整个跳过
+	for _, frame := range s.ignoreStack {
+		if frame.ignores(osPathname) {
+			if de.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+	}
+	// 跳过隐藏文件和目录，根目录本身即使以 "." 开头也不跳过
+	if s.opts.SkipHidden && strings.HasPrefix(de.Name(), ".") && !isRoot {
+		if de.IsDir() {
+			return filepath.SkipDir
+		}
+		return nil
+	}
+	// 限制递归深度：根目录的直接子项深度为 0，达到 MaxDepth 的目录不再进入
+	if s.opts.MaxDepth >= 0 && de.IsDir() && !isRoot {
+		if rel, err := filepath.Rel(root, osPathname); err == nil && strings.Count(rel, string(filepath.Separator)) >= s.opts.MaxDepth {
+			return filepath.SkipDir
+		}
+	}
+	// 不匹配 Include 的压缩包本身不记录，但仍要打开，其中的文件单独按 Include 判断
+	included := de.IsDir() || len(s.includeRegexps) == 0 || matchesAny(osPathname, s.includeRegexps)
+	if !included && !s.isArchive(osPathname) {
+		return nil
+	}
+
+	// 远程条目和内存目录树的条目已经带有文件信息，其他条目在这里 Lstat
+	fileInfo, hasInfo := de.(os.FileInfo)
+	if !hasInfo {
+		var statStart time.Time
+		if s.opts.OnStat != nil {
+			statStart = time.Now()
+		}
+		var err error
+		fileInfo, err = os.Lstat(osPathname)
+		if s.opts.OnStat != nil {
+			s.opts.OnStat(osPathname, time.Since(statStart))
+		}
+		if err != nil {
+			s.skip("lstat", osPathname, err)
+			return nil
+		}
+	}
+
+	// 位于要跳过的文件系统上的目录（通常是挂载点本身）整个跳过
+	if len(s.skipDevs) > 0 {
+		if dev, ok := deviceID(fileInfo); ok {
+			if fsType, skip := s.skipDevs[dev]; skip {
+				s.logf("Skipping %s filesystem: %s\n", fsType, osPathname)
+				if de.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+		}
+	}
+
+	if s.opts.DedupeHardlinks {
+		if id, ok := hardlinkID(fileInfo); ok {
+			if _, seen := s.seenInodes.LoadOrStore(id, true); seen {
+				s.logf("Skipping hardlink: %s\n", osPathname)
+				if s.opts.HardlinksSkipped != nil {
+					atomic.AddInt64(s.opts.HardlinksSkipped, 1)
+				}
+				return nil
+			}
+		}
+	}
+
+	if s.opts.Visit != nil && included {
+		s.opts.Visit(root, osPathname, fileInfo)
+	}
+
+	// 检查文件大小是否满足最小阈值，跟随的软链接在解析后按目标大小判断。
+	// 记录的大小和修改时间就来自这次 Lstat，不再重新 stat，避免判断和记录之间文件变化导致两者不一致。
+	// 压缩包中的文件可能比压缩包本身大，ScanArchives 时压缩包不论大小都要打开
+	isSymlink := fileInfo.Mode()&os.ModeSymlink != 0
+	inRange := included && s.sizeInRange(osPathname, s.fileSize(fileInfo))
+	isArchive := fileInfo.Mode().IsRegular() && !hasInfo && s.isArchive(osPathname)
+	if !inRange && !isArchive && !(included && isSymlink && s.opts.FollowSymlinks && !hasInfo) {
+		return nil
+	}
+
+	task := func() {
+		if fileInfo.Mode().IsDir() {
+			s.logf("Processing directory: %s\n", osPathname)
+		} else if fileInfo.Mode().IsRegular() {
+			// 跟随软链接时，根目录之下被链接指向的文件只按先遇到的一次返回
+			if !hasInfo && !s.claimTarget(osPathname) {
+				return
+			}
+			if inRange {
+				s.processFile(osPathname, fileInfo)
+			}
+			if isArchive {
+				s.processArchive(root, osPathname)
+			}
+		} else if isSymlink && !hasInfo {
+			s.processSymlink(root, osPathname)
+		} else {
+			s.logf("Skipping unknown type: %s\n", osPathname)
+		}
+	}
+
+	// 将任务发送到工作池，取消后不再投递新任务
+	select {
+	case taskQueue <- task:
+	case <-ctx.Done():
+		return errScanCancelled
+	}
+	return nil
+}
+
+// sizeInRange 判断大小是否不小于路径适用的最小大小，并且设置了 MaxSize 时不超过它
+func (s *scanner) sizeInRange(path string, size int64) bool {
+	return size >= s.minSize(path) && (s.opts.MaxSize <= 0 || size <= s.opts.MaxSize)
+}
+
+// minSize 返回路径适用的最小文件大小：扩展名有 ExtMinSize 规则时使用规则，否则使用 MinSize
+func (s *scanner) minSize(path string) int64 {
+	if len(s.opts.ExtMinSize) > 0 {
+		ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(path), "."))
+		if min, ok := s.opts.ExtMinSize[ext]; ok && ext != "" {
+			return min
+		}
+	}
+	return s.opts.MinSize
+}
+
+// pushIgnoreFile 在进入目录时读取其中的 IgnoreFile，规则作用于该目录之下的所有条目
+func (s *scanner) pushIgnoreFile(dir string) {
+	name := filepath.Join(dir, s.opts.IgnoreFile)
+	patterns, err := LoadPatterns(name)
+	if os.IsNotExist(err) {
+		return
+	}
+	if err != nil {
+		s.report("ignore", name, err, false)
+		return
+	}
+	rules, err := compileIgnoreRules(patterns, false)
+	if err != nil {
+		s.report("ignore", name, err, false)
+		return
+	}
+	s.logf("Loaded %d ignore rules from %s\n", len(rules), name)
+	s.ignoreStack = append(s.ignoreStack, &ignoreFrame{dir: filepath.Clean(dir), rules: rules})
+}
+
+// popIgnoreFile 在目录的子项处理完后移除该目录的规则
+func (s *scanner) popIgnoreFile(dir string) {
+	if n := len(s.ignoreStack); n > 0 && s.ignoreStack[n-1].dir == filepath.Clean(dir) {
+		s.ignoreStack = s.ignoreStack[:n-1]
+	}
+}
+
+// fileSize 返回用于大小阈值和记录的大小：设置了 AllocatedSize 时是占用的磁盘空间，否则是逻辑大小
+func (s *scanner) fileSize(info os.FileInfo) int64 {
+	if s.opts.AllocatedSize {
+		return AllocatedSize(info)
+	}
+	return info.Size()
+}
+
+// processFile 把判断大小阈值时使用的文件信息发送给调用者。
+// 取消后已经投递的文件仍然会发送，调用者会一直读到 channel 关闭，这样 DirDone 报告的目录中不会漏掉文件
+func (s *scanner) processFile(path string, info os.FileInfo) {
+	f := FileInfo{Path: path, Size: s.fileSize(info), ModTime: info.ModTime()}
+	if s.opts.CaptureOwner {
+		f.Owner = fileOwner(info)
+	}
+	s.out <- f
+}
+
+// claimTarget 在 FollowSymlinks 时把文件的绝对路径记入 resolvedTargets，返回这个文件是否是第一次遇到；
+// 没有开启 FollowSymlinks 时总是返回 true。直接遍历到的文件按遍历得到的路径比较，
+// 根目录本身的路径中有软链接时与链接解析出的真实路径不同，这种情况下仍可能返回两次
+func (s *scanner) claimTarget(path string) bool {
+	if !s.opts.FollowSymlinks {
+		return true
+	}
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	_, seen := s.resolvedTargets.LoadOrStore(path, true)
+	return !seen
+}
+
+// processSymlink 处理软链接：未开启 FollowSymlinks 时只打印日志；
+// 开启后解析链接目标，目标是达到大小阈值的普通文件时按目标的真实路径记录，大小和修改时间都是目标的，
+// 不是链接本身的。
+// 已处理过的真实路径记录在 resolvedTargets 中，多个链接指向同一目标、链接成环，
+// 或者目标本身也在遍历范围内时只处理一次。root 是链接所在的根目录，目标中的压缩包条目相对它应用排除规则
+func (s *scanner) processSymlink(root, path string) {
+	if !s.opts.FollowSymlinks {
+		s.logf("Processing symlink: %s\n", path)
+		return
+	}
+
+	realPath, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		s.report("symlink", path, err, false)
+		return
+	}
+	if !s.claimTarget(realPath) {
+		return
+	}
+
+	info, err := os.Stat(realPath)
+	if err != nil {
+		s.report("stat", realPath, err, false)
+		return
+	}
+	if !info.Mode().IsRegular() {
+		return
+	}
+	if s.sizeInRange(realPath, s.fileSize(info)) {
+		s.processFile(realPath, info)
+	}
+	if s.isArchive(realPath) {
+		s.processArchive(root, realPath)
+	}
+}
@@ -0,0 +1,100 @@
+package scanner
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// dirWalker 在真实目录中遍历一层，条目只有名字和是否是目录，没有实现 os.FileInfo，visit 会对它们各自 Lstat。
+// beforeVisit 在读目录之后、交给 Visit 之前调用，用来模拟读目录和 Lstat 之间文件发生的变化
+type dirWalker struct {
+	beforeVisit func(path string)
+}
+
+func (w dirWalker) Walk(root string, cb WalkCallbacks) error {
+	if err := cb.Visit(root, dirEntry{name: filepath.Base(root), dir: true}); err != nil {
+		return cb.OnError(root, err)
+	}
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return cb.OnError(root, err)
+	}
+	for _, de := range entries {
+		p := filepath.Join(root, de.Name())
+		if w.beforeVisit != nil {
+			w.beforeVisit(p)
+		}
+		if err := cb.Visit(p, dirEntry{name: de.Name(), dir: de.IsDir()}); err != nil && err != filepath.SkipDir {
+			if err := cb.OnError(p, err); err != nil {
+				return err
+			}
+		}
+	}
+	cb.DirDone(root)
+	return nil
+}
+
+// dirEntry 只实现 Dirent，不带文件信息
+type dirEntry struct {
+	name string
+	dir  bool
+}
+
+func (d dirEntry) Name() string { return d.name }
+func (d dirEntry) IsDir() bool  { return d.dir }
+
+// TestScanUsesLstatSize 检查大小阈值和返回的大小都来自 visit 中的同一次 Lstat：
+// 读目录时还很小、Lstat 前长大的文件按 Lstat 的大小返回，Lstat 之后再变小也不会影响返回的大小
+func TestScanUsesLstatSize(t *testing.T) {
+	dir := t.TempDir()
+	p := filepath.Join(dir, "growing.bin")
+	if err := os.WriteFile(p, make([]byte, 10), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	found := collect(t, Options{
+		Roots:    []string{dir},
+		MinSize:  50,
+		MaxDepth: -1,
+		Walker: dirWalker{beforeVisit: func(path string) {
+			if path == p {
+				if err := os.WriteFile(p, make([]byte, 100), 0644); err != nil {
+					t.Error(err)
+				}
+			}
+		}},
+		// Visit 在 Lstat 之后、文件交给工作池之前调用
+		Visit: func(root, path string, info os.FileInfo) {
+			if path == p {
+				if err := os.Truncate(p, 10); err != nil {
+					t.Error(err)
+				}
+			}
+		},
+	})
+	f, ok := found[p]
+	if !ok {
+		t.Fatalf("%s was not returned, want it with the size seen by Lstat", p)
+	}
+	if f.Size != 100 {
+		t.Errorf("size %d, want 100 from the Lstat used for the threshold check", f.Size)
+	}
+}
+
+// TestScanRecordsLstatInfo 检查返回的修改时间同样来自 Lstat
+func TestScanRecordsLstatInfo(t *testing.T) {
+	dir := t.TempDir()
+	p := filepath.Join(dir, "a.bin")
+	if err := os.WriteFile(p, make([]byte, 100), 0644); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Lstat(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := collect(t, Options{Roots: []string{dir}, MinSize: 1, MaxDepth: -1, Walker: dirWalker{}})
+	if f := found[p]; f.Size != 100 || !f.ModTime.Equal(info.ModTime()) {
+		t.Errorf("got %+v, want size 100 and mtime %s", f, info.ModTime())
+	}
+}
@@ -0,0 +1,51 @@
+package scanner
+
+import (
+	"github.com/karrick/godirwalk"
+)
+
+// Dirent 是遍历到的一个条目。同时实现了 os.FileInfo 的条目（远程遍历的条目、测试用的内存目录树）
+// 不会再 Lstat，达到大小阈值的普通文件直接按这份信息返回，不会访问本地文件系统
+type Dirent interface {
+	Name() string
+	IsDir() bool
+}
+
+// Walker 遍历一个本地根目录，默认使用 godirwalk；测试中可以换成内存中的目录树，
+// 不需要真实的文件系统就能检查过滤规则和任务分派
+type Walker interface {
+	Walk(root string, cb WalkCallbacks) error
+}
+
+// WalkCallbacks 是 Walker 遍历时调用的回调，都在调用 Walk 的 goroutine 中执行
+type WalkCallbacks struct {
+	// Visit 对包括根目录在内的每个条目调用，目录先于它的子项；对目录返回 filepath.SkipDir 时不进入该目录，
+	// 返回其他错误时交给 OnError
+	Visit func(path string, de Dirent) error
+	// DirDone 在一个进入过的目录的子项都遍历完后调用
+	DirDone func(path string)
+	// OnError 接收遍历中出错的条目：返回 nil 时跳过该条目继续遍历，返回错误时停止遍历，由 Walk 返回该错误
+	OnError func(path string, err error) error
+}
+
+// godirwalkWalker 是默认的 Walker
+type godirwalkWalker struct{}
+
+func (godirwalkWalker) Walk(root string, cb WalkCallbacks) error {
+	return godirwalk.Walk(root, &godirwalk.Options{
+		Callback: func(osPathname string, de *godirwalk.Dirent) error {
+			return cb.Visit(osPathname, de)
+		},
+		PostChildrenCallback: func(osPathname string, de *godirwalk.Dirent) error {
+			cb.DirDone(osPathname)
+			return nil
+		},
+		ErrorCallback: func(osPathname string, err error) godirwalk.ErrorAction {
+			if cb.OnError(osPathname, err) != nil {
+				return godirwalk.Halt
+			}
+			return godirwalk.SkipNode
+		},
+		Unsorted: true,
+	})
+}
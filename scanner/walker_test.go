@@ -0,0 +1,309 @@
+package scanner
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// memFile 是内存目录树中的一个条目，同时实现了 Dirent 和 os.FileInfo，visit 不会再 Lstat 它
+type memFile struct {
+	name    string
+	size    int64
+	mode    os.FileMode
+	modTime time.Time
+}
+
+func (f memFile) Name() string       { return f.name }
+func (f memFile) Size() int64        { return f.size }
+func (f memFile) Mode() os.FileMode  { return f.mode }
+func (f memFile) ModTime() time.Time { return f.modTime }
+func (f memFile) IsDir() bool        { return f.mode.IsDir() }
+func (f memFile) Sys() interface{}   { return nil }
+
+// memTree 是测试用的 Walker，遍历内存中的目录树，子项按名字排序
+type memTree struct {
+	entries  map[string]memFile
+	children map[string][]string
+}
+
+// memModTime 是内存目录树中所有条目的修改时间
+var memModTime = time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+// newMemTree 用 "路径=大小" 形式的条目建立以 root 为根的目录树，中间的目录自动创建；
+// 以 "/" 结尾的条目是空目录，"路径@" 是一个软链接
+func newMemTree(root string, specs ...string) *memTree {
+	t := &memTree{entries: make(map[string]memFile), children: make(map[string][]string)}
+	root = filepath.Clean(root)
+	t.entries[root] = memFile{name: filepath.Base(root), mode: os.ModeDir | 0755, modTime: memModTime}
+	for _, spec := range specs {
+		name, sizeStr, _ := strings.Cut(spec, "=")
+		f := memFile{mode: 0644, modTime: memModTime}
+		switch {
+		case strings.HasSuffix(name, "/"):
+			f.mode = os.ModeDir | 0755
+		case strings.HasSuffix(name, "@"):
+			name = strings.TrimSuffix(name, "@")
+			f.mode = os.ModeSymlink | 0777
+		}
+		if sizeStr != "" {
+			size, err := parseTestSize(sizeStr)
+			if err != nil {
+				panic(err)
+			}
+			f.size = size
+		}
+		p := filepath.Join(root, filepath.FromSlash(strings.TrimSuffix(name, "/")))
+		f.name = filepath.Base(p)
+		t.add(root, p, f)
+	}
+	for dir := range t.children {
+		sort.Strings(t.children[dir])
+	}
+	return t
+}
+
+func parseTestSize(s string) (int64, error) {
+	var n int64
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return 0, os.ErrInvalid
+		}
+		n = n*10 + int64(c-'0')
+	}
+	return n, nil
+}
+
+// add 加入条目 p，并创建它所有还不存在的上级目录
+func (t *memTree) add(root, p string, f memFile) {
+	if _, ok := t.entries[p]; ok {
+		return
+	}
+	t.entries[p] = f
+	if p == root {
+		return
+	}
+	parent := filepath.Dir(p)
+	t.children[parent] = append(t.children[parent], p)
+	t.add(root, parent, memFile{name: filepath.Base(parent), mode: os.ModeDir | 0755, modTime: memModTime})
+}
+
+func (t *memTree) Walk(root string, cb WalkCallbacks) error {
+	return t.walk(filepath.Clean(root), cb)
+}
+
+func (t *memTree) walk(p string, cb WalkCallbacks) error {
+	f, ok := t.entries[p]
+	if !ok {
+		return cb.OnError(p, os.ErrNotExist)
+	}
+	if err := cb.Visit(p, f); err != nil {
+		if err == filepath.SkipDir {
+			return nil
+		}
+		return cb.OnError(p, err)
+	}
+	if !f.IsDir() {
+		return nil
+	}
+	for _, child := range t.children[p] {
+		if err := t.walk(child, cb); err != nil {
+			return err
+		}
+	}
+	cb.DirDone(p)
+	return nil
+}
+
+// collect 运行一次扫描，返回按路径索引的结果；扫描中报告的错误让测试失败
+func collect(t *testing.T, opts Options) map[string]FileInfo {
+	t.Helper()
+	opts.OnError = func(err *Error) {
+		t.Errorf("scan error: %v", err)
+	}
+	files, err := Scan(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("Scan: %v", err)
+	}
+	found := make(map[string]FileInfo)
+	for f := range files {
+		if _, dup := found[f.Path]; dup {
+			t.Errorf("%s returned twice", f.Path)
+		}
+		found[f.Path] = f
+	}
+	return found
+}
+
+// assertPaths 检查结果中正好是 want 这些路径（相对于 root）和对应的大小
+func assertPaths(t *testing.T, root string, found map[string]FileInfo, want map[string]int64) {
+	t.Helper()
+	for rel, size := range want {
+		p := filepath.Join(root, filepath.FromSlash(rel))
+		f, ok := found[p]
+		if !ok {
+			t.Errorf("%s was not returned", rel)
+			continue
+		}
+		if f.Size != size {
+			t.Errorf("%s: size %d, want %d", rel, f.Size, size)
+		}
+	}
+	for p := range found {
+		rel, _ := filepath.Rel(root, p)
+		if _, ok := want[filepath.ToSlash(rel)]; !ok {
+			t.Errorf("%s should not have been returned", rel)
+		}
+	}
+}
+
+func TestScanMemTreeFilters(t *testing.T) {
+	root := filepath.FromSlash("/data")
+	tree := newMemTree(root,
+		"big.mkv=500",
+		"small.mkv=50",
+		"exact.bin=100",
+		"scratch.tmp=900",
+		"disc.ISO=900",
+		"cache/blob=900",
+		"keep/cache/blob=900",
+		"web/node_modules/lib.js=900",
+		".hidden/film.mkv=900",
+		".dotfile=900",
+		"deep/a/b/c/film.mkv=900",
+		"empty/",
+	)
+	found := collect(t, Options{
+		Roots:       []string{root},
+		MinSize:     100,
+		Exclude:     []string{"*.tmp", "cache/*", "node_modules"},
+		ExcludeExts: []string{"iso"},
+		SkipHidden:  true,
+		MaxDepth:    -1,
+		Walker:      tree,
+	})
+	assertPaths(t, root, found, map[string]int64{
+		"big.mkv":             500,
+		"exact.bin":           100,
+		"keep/cache/blob":     900,
+		"deep/a/b/c/film.mkv": 900,
+	})
+	if f := found[filepath.Join(root, "big.mkv")]; !f.ModTime.Equal(memModTime) {
+		t.Errorf("big.mkv: mtime %s, want %s", f.ModTime, memModTime)
+	}
+}
+
+func TestScanMemTreeSizeRange(t *testing.T) {
+	root := filepath.FromSlash("/data")
+	tree := newMemTree(root, "a.log=20", "b.log=5", "c.mkv=20", "d.mkv=2000", "e.mkv=200")
+	found := collect(t, Options{
+		Roots:      []string{root},
+		MinSize:    100,
+		MaxSize:    1000,
+		ExtMinSize: map[string]int64{"log": 10},
+		MaxDepth:   -1,
+		Walker:     tree,
+	})
+	assertPaths(t, root, found, map[string]int64{"a.log": 20, "e.mkv": 200})
+}
+
+func TestScanMemTreeIncludeAndDepth(t *testing.T) {
+	root := filepath.FromSlash("/data")
+	tree := newMemTree(root, "a.mkv=10", "a.txt=10", "sub/b.mkv=10", "sub/deeper/c.mkv=10")
+	found := collect(t, Options{
+		Roots:    []string{root},
+		Include:  []string{"*.mkv"},
+		MaxDepth: 1,
+		Walker:   tree,
+	})
+	// 根目录的直接子项深度为 0，sub 的深度为 0，sub/deeper 的深度为 1，不再进入
+	assertPaths(t, root, found, map[string]int64{"a.mkv": 10, "sub/b.mkv": 10})
+}
+
+func TestScanMemTreeSymlinksSkipped(t *testing.T) {
+	root := filepath.FromSlash("/data")
+	tree := newMemTree(root, "film.mkv=500", "link.mkv@=500")
+	// 内存树中的软链接没有可以解析的目标，无论是否 FollowSymlinks 都不返回
+	for _, follow := range []bool{false, true} {
+		found := collect(t, Options{Roots: []string{root}, MaxDepth: -1, FollowSymlinks: follow, Walker: tree})
+		assertPaths(t, root, found, map[string]int64{"film.mkv": 500})
+	}
+}
+
+func TestScanMemTreeSkipDir(t *testing.T) {
+	root := filepath.FromSlash("/data")
+	tree := newMemTree(root, "done/a=10", "todo/b=10")
+	var finished []string
+	found := collect(t, Options{
+		Roots:    []string{root},
+		MaxDepth: -1,
+		Walker:   tree,
+		SkipDir:  func(p string) bool { return filepath.Base(p) == "done" },
+		DirDone:  func(p string) { finished = append(finished, p) },
+	})
+	assertPaths(t, root, found, map[string]int64{"todo/b": 10})
+	want := []string{filepath.Join(root, "todo"), root}
+	if strings.Join(finished, ",") != strings.Join(want, ",") {
+		t.Errorf("DirDone called for %q, want %q", finished, want)
+	}
+}
+
+// TestScanFollowSymlinks 在真实的文件系统上检查指向根目录之外的软链接：
+// 跟随时按目标的真实路径只返回一次，大小是目标的；不跟随时不返回
+func TestScanFollowSymlinks(t *testing.T) {
+	outside := t.TempDir()
+	target := filepath.Join(outside, "film.mkv")
+	if err := os.WriteFile(target, make([]byte, 100), 0644); err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	for _, name := range []string{"link1.mkv", "link2.mkv"} {
+		if err := os.Symlink(target, filepath.Join(dir, name)); err != nil {
+			t.Skipf("symlinks not supported: %v", err)
+		}
+	}
+	// EvalSymlinks 得到的真实路径可能与 TempDir 不同（例如 macOS 的 /private/var）
+	realTarget, err := filepath.EvalSymlinks(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	found := collect(t, Options{Roots: []string{dir}, MinSize: 100, MaxDepth: -1, FollowSymlinks: true})
+	if len(found) != 1 {
+		t.Errorf("got %d files, want only %s", len(found), realTarget)
+	}
+	if f, ok := found[realTarget]; !ok || f.Size != 100 {
+		t.Errorf("target not returned with its own size: %v", found)
+	}
+
+	if found := collect(t, Options{Roots: []string{dir}, MinSize: 100, MaxDepth: -1}); len(found) != 0 {
+		t.Errorf("without FollowSymlinks got %v, want nothing", found)
+	}
+}
+
+// TestScanFollowSymlinksInsideRoot 检查链接的目标也在根目录之下时，目标只返回一次
+func TestScanFollowSymlinksInsideRoot(t *testing.T) {
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	target := filepath.Join(dir, "film.mkv")
+	if err := os.WriteFile(target, make([]byte, 100), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a-link.mkv", "z-link.mkv"} {
+		if err := os.Symlink(target, filepath.Join(dir, name)); err != nil {
+			t.Skipf("symlinks not supported: %v", err)
+		}
+	}
+	for i := 0; i < 20; i++ {
+		found := collect(t, Options{Roots: []string{dir}, MinSize: 100, MaxDepth: -1, FollowSymlinks: true})
+		if _, ok := found[target]; !ok || len(found) != 1 {
+			t.Fatalf("got %v, want only %s", found, target)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// sizeRules 把扩展名（小写、不带点）映射到该扩展名的最小文件大小，没有规则的扩展名使用 -min-size
+type sizeRules map[string]int64
+
+// parseSizeRule 解析一条 "ext=log,min=10M" 形式的规则
+func parseSizeRule(s string) (string, int64, error) {
+	var ext, min string
+	for _, field := range strings.Split(s, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(field), "=")
+		if !ok {
+			return "", 0, fmt.Errorf("invalid rule %q, want ext=EXT,min=SIZE", s)
+		}
+		switch key {
+		case "ext":
+			ext = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(value), "."))
+		case "min":
+			min = value
+		default:
+			return "", 0, fmt.Errorf("invalid rule %q: unknown field %q", s, key)
+		}
+	}
+	if ext == "" || min == "" {
+		return "", 0, fmt.Errorf("invalid rule %q, want ext=EXT,min=SIZE", s)
+	}
+	size, err := parseSize(min)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid rule %q: %w", s, err)
+	}
+	return ext, size, nil
+}
+
+// String 按扩展名排序输出所有规则
+func (r *sizeRules) String() string {
+	if r == nil {
+		return ""
+	}
+	exts := make([]string, 0, len(*r))
+	for ext := range *r {
+		exts = append(exts, ext)
+	}
+	sort.Strings(exts)
+	rules := make([]string, len(exts))
+	for i, ext := range exts {
+		rules[i] = fmt.Sprintf("ext=%s,min=%d", ext, (*r)[ext])
+	}
+	return strings.Join(rules, " ")
+}
+
+// Set 添加一条 -rule，同一个扩展名后面的规则覆盖前面的
+func (r *sizeRules) Set(s string) error {
+	ext, size, err := parseSizeRule(s)
+	if err != nil {
+		return err
+	}
+	if *r == nil {
+		*r = make(sizeRules)
+	}
+	(*r)[ext] = size
+	return nil
+}
+
+// loadSizeRules 读取规则文件，每行一条规则，空行和 "#" 开头的行会被忽略
+func loadSizeRules(filename string) (sizeRules, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	rules := make(sizeRules)
+	lineNo := 0
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if err := rules.Set(line); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", filename, lineNo, err)
+		}
+	}
+	return rules, scanner.Err()
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"container/heap"
+	"sort"
+	"time"
+)
+
+// statTiming 是一次 Lstat 调用花费的时间
+type statTiming struct {
+	Path    string
+	Elapsed time.Duration
+}
+
+// slowStats 只保留最慢的 limit 次 Lstat，是以耗时为序的最小堆，堆顶是保留的记录中最快的一条。
+// 它只在遍历的 goroutine 中使用，不需要加锁
+type slowStats struct {
+	entries []statTiming
+	limit   int
+}
+
+func newSlowStats(limit int) *slowStats {
+	return &slowStats{limit: limit}
+}
+
+func (s *slowStats) Len() int           { return len(s.entries) }
+func (s *slowStats) Less(i, j int) bool { return s.entries[i].Elapsed < s.entries[j].Elapsed }
+func (s *slowStats) Swap(i, j int)      { s.entries[i], s.entries[j] = s.entries[j], s.entries[i] }
+func (s *slowStats) Push(x interface{}) { s.entries = append(s.entries, x.(statTiming)) }
+func (s *slowStats) Pop() interface{} {
+	last := s.entries[len(s.entries)-1]
+	s.entries = s.entries[:len(s.entries)-1]
+	return last
+}
+
+// add 记录一次 Lstat 的耗时，超出容量时淘汰最快的一条
+func (s *slowStats) add(path string, elapsed time.Duration) {
+	if len(s.entries) < s.limit {
+		heap.Push(s, statTiming{Path: path, Elapsed: elapsed})
+		return
+	}
+	if elapsed <= s.entries[0].Elapsed {
+		return
+	}
+	s.entries[0] = statTiming{Path: path, Elapsed: elapsed}
+	heap.Fix(s, 0)
+}
+
+// sorted 返回保留的记录，按耗时从长到短排序
+func (s *slowStats) sorted() []statTiming {
+	result := append([]statTiming(nil), s.entries...)
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Elapsed != result[j].Elapsed {
+			return result[i].Elapsed > result[j].Elapsed
+		}
+		return result[i].Path < result[j].Path
+	})
+	return result
+}
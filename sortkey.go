@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// sortKey 是日志的排序方式，每种排序方式写入一个单独的日志文件
+type sortKey string
+
+const (
+	sortSize  sortKey = "size"  // 按大小从大到小，写入 fav.log
+	sortMtime sortKey = "mtime" // 按修改时间从新到旧，写入 fav.log.sort
+	sortPath  sortKey = "path"  // 按路径的字典序，写入 fav.log.path，便于对比不同时间的扫描结果
+)
+
+// defaultSortKeys 是没有指定 -sort 时生成的日志
+var defaultSortKeys = []sortKey{sortSize, sortMtime}
+
+// sizeLogName 和 mtimeLogName 是 -out 和 -out-sorted 指定的按大小、按修改时间排序的日志名
+var sizeLogName = "fav.log"
+var mtimeLogName = "fav.log.sort"
+
+// logName 返回该排序方式对应的日志文件名，不含格式和压缩后缀
+func (k sortKey) logName() string {
+	switch k {
+	case sortMtime:
+		return mtimeLogName
+	case sortPath:
+		return "fav.log.path"
+	}
+	return sizeLogName
+}
+
+// validateLogNames 检查 -out 和 -out-sorted：必须是输出目录中的文件名，且各个日志的名字互不相同，避免互相覆盖
+func validateLogNames() error {
+	seen := make(map[string]sortKey)
+	for _, k := range []sortKey{sortSize, sortMtime, sortPath} {
+		name := k.logName()
+		if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+			return fmt.Errorf("invalid log name %q, use -out-dir to choose the directory", name)
+		}
+		if other, ok := seen[name]; ok {
+			return fmt.Errorf("the %s and %s logs would both be written to %s", other, k, name)
+		}
+		seen[name] = k
+	}
+	return nil
+}
+
+// parseSortKey 解析一个排序方式的名字
+func parseSortKey(s string) (sortKey, error) {
+	switch k := sortKey(strings.TrimSpace(s)); k {
+	case sortSize, sortMtime, sortPath:
+		return k, nil
+	}
+	return "", fmt.Errorf("invalid sort %q, want size, mtime or path", s)
+}
+
+// sortKeyList 是 -sort 的 flag.Value，接受逗号分隔的排序方式，例如 "size,path"
+type sortKeyList struct {
+	keys *[]sortKey
+}
+
+func (l sortKeyList) String() string {
+	if l.keys == nil {
+		return ""
+	}
+	names := make([]string, len(*l.keys))
+	for i, k := range *l.keys {
+		names[i] = string(k)
+	}
+	return strings.Join(names, ",")
+}
+
+func (l sortKeyList) Set(s string) error {
+	var keys []sortKey
+	for _, name := range strings.Split(s, ",") {
+		k, err := parseSortKey(name)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, k)
+	}
+	*l.keys = keys
+	return nil
+}
+
+// entryLess 判断 a 在输出中是否应排在 b 之前，与 sortKeys 的顺序一致；
+// reverse 为 true 时顺序反过来，即从小到大、从旧到新或路径倒序。
+// 大小或修改时间相同的记录总是按路径从小到大排列，同样的输入每次得到同样的日志，便于比较两次扫描
+func entryLess(a, b fileEntry, key sortKey, reverse bool) bool {
+	if key != sortPath && sameSortValue(a, b, key) {
+		return a.Path < b.Path
+	}
+	if reverse {
+		a, b = b, a
+	}
+	switch key {
+	case sortMtime:
+		return a.Info.ModTime.After(b.Info.ModTime)
+	case sortPath:
+		return a.Path < b.Path
+	}
+	return a.Info.Size > b.Info.Size
+}
+
+// sameSortValue 判断 a 和 b 的排序字段（修改时间或大小）是否相同
+func sameSortValue(a, b fileEntry, key sortKey) bool {
+	if key == sortMtime {
+		return a.Info.ModTime.Equal(b.Info.ModTime)
+	}
+	return a.Info.Size == b.Info.Size
+}
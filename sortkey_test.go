@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"math/rand"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// tieFixture 中 b、d、a、c 大小相同，e 更大；修改时间同样有相同的
+var tieFixture = map[string]FileInfo{
+	"/scan/b.mkv": {Size: 100, ModTime: time.Unix(1000, 0)},
+	"/scan/d.mkv": {Size: 100, ModTime: time.Unix(1000, 0)},
+	"/scan/a.mkv": {Size: 100, ModTime: time.Unix(2000, 0)},
+	"/scan/c.mkv": {Size: 100, ModTime: time.Unix(1000, 0)},
+	"/scan/e.mkv": {Size: 500, ModTime: time.Unix(2000, 0)},
+}
+
+func shuffledKeys(data map[string]FileInfo, rng *rand.Rand) []string {
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	rng.Shuffle(len(keys), func(i, j int) { keys[i], keys[j] = keys[j], keys[i] })
+	return keys
+}
+
+// TestSortKeysTieBreak 检查大小或修改时间相同的记录不论输入顺序如何，总是按路径从小到大排列
+func TestSortKeysTieBreak(t *testing.T) {
+	tests := []struct {
+		key     sortKey
+		reverse bool
+		want    string
+	}{
+		{sortSize, false, "e a b c d"},
+		{sortSize, true, "a b c d e"},
+		{sortMtime, false, "a e b c d"},
+		{sortMtime, true, "b c d a e"},
+	}
+	rng := rand.New(rand.NewSource(1))
+	for _, tt := range tests {
+		for i := 0; i < 20; i++ {
+			keys := shuffledKeys(tieFixture, rng)
+			sortKeys(keys, tieFixture, tt.key, tt.reverse)
+			if got := baseNames(keys); got != tt.want {
+				t.Fatalf("sort %s (reverse %v) of %q: got %s, want %s", tt.key, tt.reverse, keys, got, tt.want)
+			}
+		}
+	}
+}
+
+// baseNames 把 "/scan/a.mkv" 这样的路径列表写成 "a b ..."，便于比较
+func baseNames(keys []string) string {
+	names := make([]string, len(keys))
+	for i, k := range keys {
+		names[i] = strings.TrimSuffix(strings.TrimPrefix(k, "/scan/"), ".mkv")
+	}
+	return strings.Join(names, " ")
+}
+
+// TestCollectEntriesTopTies 检查 -top 在相同大小的记录中保留的也总是路径靠前的那些，与存储遍历的顺序无关
+func TestCollectEntriesTopTies(t *testing.T) {
+	store := newMemoryStore()
+	ctx := context.Background()
+	for p, fi := range tieFixture {
+		if err := store.Put(ctx, p, fi); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 20; i++ {
+		_, sorted, err := collectEntries(ctx, store, []sortKey{sortSize}, saveOptions{top: 3})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := baseNames(sorted[sortSize]); got != "e a b" {
+			t.Fatalf("top 3 by size: got %s, want e a b", got)
+		}
+	}
+}
+
+// TestSaveToFileReproducible 检查同样的记录以不同的顺序写出时，日志的内容完全相同
+func TestSaveToFileReproducible(t *testing.T) {
+	withOutDir(t)
+	rng := rand.New(rand.NewSource(2))
+	var first []byte
+	for i := 0; i < 5; i++ {
+		keys := shuffledKeys(tieFixture, rng)
+		sortKeys(keys, tieFixture, sortSize, false)
+		if err := saveToFile("/scan", "fav.log", "csv", keys, tieFixture, sortSize, saveOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		got, err := os.ReadFile(outputPath("fav.log"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if first == nil {
+			first = got
+		} else if string(got) != string(first) {
+			t.Fatalf("fav.log differs between runs:\n%s\nvs\n%s", first, got)
+		}
+	}
+}
+
+// orderFixture 中大小、修改时间和路径的顺序各不相同
+var orderFixture = map[string]FileInfo{
+	"/scan/a.mkv": {Size: 300, ModTime: time.Unix(1000, 0)},
+	"/scan/b.mkv": {Size: 100, ModTime: time.Unix(3000, 0)},
+	"/scan/c.mkv": {Size: 200, ModTime: time.Unix(2000, 0)},
+}
+
+func TestSortKeysOrder(t *testing.T) {
+	tests := []struct {
+		key     sortKey
+		reverse bool
+		want    string
+	}{
+		{sortSize, false, "a c b"},  // 从大到小
+		{sortSize, true, "b c a"},   // 从小到大
+		{sortMtime, false, "b c a"}, // 从新到旧
+		{sortMtime, true, "a c b"},  // 从旧到新
+		{sortPath, false, "a b c"},
+		{sortPath, true, "c b a"},
+	}
+	rng := rand.New(rand.NewSource(3))
+	for _, tt := range tests {
+		keys := shuffledKeys(orderFixture, rng)
+		sortKeys(keys, orderFixture, tt.key, tt.reverse)
+		if got := baseNames(keys); got != tt.want {
+			t.Errorf("sort %s (reverse %v): got %s, want %s", tt.key, tt.reverse, got, tt.want)
+		}
+	}
+}
+
+// TestCollectEntriesReverseTop 检查 -reverse 和 -top 一起使用时保留的是最小、最旧的记录
+func TestCollectEntriesReverseTop(t *testing.T) {
+	store := newMemoryStore()
+	ctx := context.Background()
+	for p, fi := range orderFixture {
+		if err := store.Put(ctx, p, fi); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, reverse := range []bool{false, true} {
+		_, sorted, err := collectEntries(ctx, store, []sortKey{sortSize, sortMtime}, saveOptions{top: 2, reverse: reverse})
+		if err != nil {
+			t.Fatal(err)
+		}
+		wantSize, wantMtime := "a c", "b c"
+		if reverse {
+			wantSize, wantMtime = "b c", "a c"
+		}
+		if got := baseNames(sorted[sortSize]); got != wantSize {
+			t.Errorf("reverse %v, top 2 by size: got %s, want %s", reverse, got, wantSize)
+		}
+		if got := baseNames(sorted[sortMtime]); got != wantMtime {
+			t.Errorf("reverse %v, top 2 by mtime: got %s, want %s", reverse, got, wantMtime)
+		}
+	}
+}
+
+// TestReverseLogOrder 检查 -reverse 写出的 fav.log 从小到大排列
+func TestReverseLogOrder(t *testing.T) {
+	withOutDir(t)
+	var opts saveOptions
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	addOutputFlags(fs, &opts)
+	if err := fs.Parse([]string{"-reverse", "-abs-paths"}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sizeLogName, mtimeLogName = "fav.log", "fav.log.sort" })
+
+	keys := shuffledKeys(orderFixture, rand.New(rand.NewSource(4)))
+	sortKeys(keys, orderFixture, sortSize, opts.reverse)
+	if err := saveToFile("/scan", "fav.log", "csv", keys, orderFixture, sortSize, opts); err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Open(outputPath("fav.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	entries, err := parseLog(file, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, e := range entries {
+		got = append(got, e.Path)
+	}
+	if names := baseNames(got); names != "b c a" {
+		t.Errorf("fav.log with -reverse: got %s, want b c a", names)
+	}
+}
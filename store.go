@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Store 是扫描结果的存储后端，processFile 通过 Put 写入，saveToFile 通过 Iterate 读取
+type Store interface {
+	// Put 保存一个文件的信息，已存在的记录会被覆盖
+	Put(ctx context.Context, path string, fi FileInfo) error
+	// Get 读取一个文件的记录，ok 为 false 表示没有记录
+	Get(ctx context.Context, path string) (fi FileInfo, ok bool, err error)
+	// Iterate 对当前命名空间下的每条记录调用 fn，fn 返回错误时停止遍历并返回该错误
+	Iterate(ctx context.Context, fn func(path string, fi FileInfo) error) error
+	// Delete 删除一个文件的记录，记录不存在时不返回错误
+	Delete(ctx context.Context, path string) error
+	// Flush 把缓冲中还没写入的 Put 写到后端，之后的 Get 和 Iterate 能看到它们；不缓冲写入的后端什么也不做
+	Flush(ctx context.Context) error
+	// Close 会先尽量写入缓冲中剩下的记录
+	Close() error
+}
+
+var storeType string        // Cache backend, redis, sqlite, memory or none
+var sqlitePath string       // SQLite database file for -store sqlite
+var opTimeout time.Duration // Deadline for a single store operation, 0 disables it
+var redisAddr string        // Redis server address
+var redisPassword string    // Redis password
+var redisDB int             // Redis logical database
+var namespace string        // Scopes the entries of one scan inside a store
+var cacheTTL time.Duration  // Expiration of cached entries, 0 keeps them forever
+var redisPoolSize int       // Connections in the go-redis pool, 0 uses its default
+var redisBatchSize int      // Puts buffered into one pipeline, 1 writes every file on its own
+var batchWait time.Duration // Longest time a buffered Put waits before it is written
+
+// errStopIteration 用于在 Iterate 的回调中提前结束遍历
+var errStopIteration = errors.New("stop iteration")
+
+// errStoreUnavailable 表示存储连续多次写入失败，已经不再可用；扫描应当停止，而不是继续遍历、逐个报错
+var errStoreUnavailable = errors.New("store unavailable")
+
+// getEnv 返回环境变量的值，未设置时返回 fallback
+func getEnv(key, fallback string) string {
+	if value, ok := os.LookupEnv(key); ok {
+		return value
+	}
+	return fallback
+}
+
+// addStoreFlags 注册存储后端相关的参数，扫描和 report 子命令共用
+func addStoreFlags(fs *flag.FlagSet) {
+	fs.StringVar(&storeType, "store", "redis", "cache backend: redis, sqlite, or memory (also called none) for a one-off scan that keeps nothing")
+	fs.StringVar(&sqlitePath, "db", "scan.db", "SQLite database file used with -store sqlite")
+	fs.StringVar(&redisAddr, "redis-addr", getEnv("REDIS_ADDR", "localhost:6379"), "Redis server address (env REDIS_ADDR)")
+	fs.StringVar(&redisPassword, "redis-password", getEnv("REDIS_PASSWORD", ""), "Redis password (env REDIS_PASSWORD)")
+	fs.IntVar(&redisDB, "redis-db", 0, "Redis logical database number")
+	fs.IntVar(&redisPoolSize, "redis-pool-size", 0, "maximum number of Redis connections, 0 uses 10 per CPU")
+	fs.DurationVar(&opTimeout, "op-timeout", 30*time.Second, "timeout for individual store operations, 0 disables it")
+	fs.StringVar(&namespace, "namespace", "", "namespace of the scan in the store (default derived from the absolute root directory)")
+	fs.Var(hashAlgoFlag{}, "hash-algo", "hash for cache keys and file contents: "+strings.Join(hashAlgoNames(), ", ")+"; Redis entries cached with another algorithm are not reused")
+}
+
+// openStore 按 -store 参数打开存储后端
+func openStore(ctx context.Context) (Store, error) {
+	switch storeType {
+	case "redis":
+		return newRedisStore(ctx, redisAddr, redisPassword, redisDB, namespace, cacheTTL, redisPoolSize, redisBatchSize, batchWait)
+	case "sqlite":
+		return newSQLiteStore(ctx, sqlitePath, namespace)
+	case "memory", "none":
+		// 没有缓存时记录只保存在内存中，扫描结束后直接排序写出日志
+		return newMemoryStore(), nil
+	default:
+		return nil, fmt.Errorf("unknown store %q", storeType)
+	}
+}
+
+// storeIsEmpty 判断存储中当前命名空间下是否还没有任何记录
+func storeIsEmpty(ctx context.Context, store Store) (bool, error) {
+	empty := true
+	err := store.Iterate(ctx, func(string, FileInfo) error {
+		empty = false
+		return errStopIteration
+	})
+	if errors.Is(err, errStopIteration) {
+		err = nil
+	}
+	return empty, err
+}
+
+// withOpTimeout 为单次存储操作派生一个带 -op-timeout 超时的 context
+func withOpTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if opTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, opTimeout)
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"sync"
+)
+
+// memoryStore 把扫描结果保存在进程内存中，不需要任何外部服务，进程退出后数据不会保留，
+// 适合一次性的扫描和测试；report、gc 等读取已有缓存的子命令对它没有意义
+type memoryStore struct {
+	mu      sync.RWMutex
+	entries map[string]FileInfo
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{entries: make(map[string]FileInfo)}
+}
+
+func (s *memoryStore) Put(ctx context.Context, path string, fi FileInfo) error {
+	s.mu.Lock()
+	s.entries[path] = fi
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *memoryStore) Get(ctx context.Context, path string) (FileInfo, bool, error) {
+	s.mu.RLock()
+	fi, ok := s.entries[path]
+	s.mu.RUnlock()
+	return fi, ok, nil
+}
+
+// Iterate 遍历调用时的一份快照，fn 中可以继续读写同一个 store
+func (s *memoryStore) Iterate(ctx context.Context, fn func(path string, fi FileInfo) error) error {
+	s.mu.RLock()
+	snapshot := make([]fileEntry, 0, len(s.entries))
+	for path, fi := range s.entries {
+		snapshot = append(snapshot, fileEntry{Path: path, Info: fi})
+	}
+	s.mu.RUnlock()
+
+	for _, e := range snapshot {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(e.Path, e.Info); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *memoryStore) Delete(ctx context.Context, path string) error {
+	s.mu.Lock()
+	delete(s.entries, path)
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *memoryStore) Flush(ctx context.Context) error {
+	return nil
+}
+
+func (s *memoryStore) Close() error {
+	return nil
+}
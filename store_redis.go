@@ -0,0 +1,566 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"github.com/go-redis/redis/v8"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// redisStore 把扫描结果保存在 Redis 中，每个文件对应一个 hash：
+// scan:<ns>:entry:<hash> 的字段 path、size、mtime（Unix 纳秒）分别保存原始路径、大小和修改时间，
+// checksum 保存 -verify 扫描计算的内容校验和，owner 保存 -capture-owner 扫描记录的 "uid:gid:mode"，
+// type 保存 -detect-type 扫描判断的内容类型（没有时都为空）。
+//
+// -hash-algo 不是 sha256 时 key 的哈希不同，前缀变为 scan:<ns>:<algo>:，
+// 不同算法的记录各占一块 key 空间，不会把一种算法的 key 当成另一种算法的来使用。
+//
+// 旧版本每个文件使用两个 key：scan:<ns>:<hash> 保存 gob 编码的 FileInfo，
+// scan:<ns>:path:<hash> 保存原始路径。读取时两种格式都会识别，重新写入一条记录时会删除它的旧 key，
+// migrate 子命令可以一次性把剩下的旧记录转换为新格式。
+//
+// batchSize 大于 1 时 Put 先放进缓冲，攒够 batchSize 条或等待 batchWait 后用一个管道一起写入，
+// Flush 和 Close 会写入剩下的记录。
+//
+// 因为暂时性错误写入失败的批次放回缓冲，不算作写入失败，之后的 Put、Flush 或 Close 会再写一次；
+// 连续 redisFailureLimit 批失败后认为 Redis 已经不可用：之后的 Put 不再访问 Redis，
+// 只把记录留在缓冲中并返回 errStoreUnavailable，由 Flush 和 Close 在 Redis 恢复后再写一次。
+// 缓冲最多保留 redisPendingLimit 条记录，超出的记录被丢弃并计数，由 Flush 报告一次。
+type redisStore struct {
+	client *redis.Client
+	prefix string
+	ttl    time.Duration
+
+	batchSize int
+	flushCtx  context.Context // 后台定时写入使用的 context，即打开存储时的 ctx
+	mu        sync.Mutex
+	pending   []redisWrite
+	flushErr  error         // 后台定时写入失败的错误，由下一次 Put 或 Flush 返回
+	stop      chan struct{} // 关闭后后台定时写入的 goroutine 退出
+	stopped   chan struct{}
+	failures  int   // 连续失败的批次数
+	brokenErr error // 连续失败达到 redisFailureLimit 时的错误，不为 nil 时 Put 不再访问 Redis
+
+	lastErr error // 最近一次放回缓冲的批次的写入错误，Flush 之后仍有记录没写入时返回
+	dropped int   // 缓冲已满而丢弃的记录数，由 Flush 报告
+}
+
+// redisWrite 是一条等待写入的记录
+type redisWrite struct {
+	path string
+	info FileInfo
+}
+
+// newRedisStore 连接 Redis 并确认服务可用，poolSize 为 0 时使用 go-redis 默认的连接池大小
+func newRedisStore(ctx context.Context, addr, password string, db int, namespace string, ttl time.Duration,
+	poolSize, batchSize int, batchWait time.Duration) (*redisStore, error) {
+	client := redis.NewClient(&redis.Options{
+		Addr:     addr,
+		Password: password,
+		DB:       db,
+		PoolSize: poolSize,
+	})
+	// Redis 可能还在启动，连接时多重试几次
+	err := withRetry(ctx, redisPingAttempts, "ping", func(opCtx context.Context) error {
+		return client.Ping(opCtx).Err()
+	})
+	if err != nil {
+		client.Close()
+		return nil, fmt.Errorf("connecting to Redis at %s (db %d): %w", addr, db, err)
+	}
+	prefix := "scan:" + namespace + ":"
+	if hashAlgo != defaultHashAlgo {
+		prefix += hashAlgo + ":"
+	}
+	s := &redisStore{client: client, prefix: prefix, ttl: ttl, batchSize: batchSize, flushCtx: ctx}
+	if batchSize > 1 && batchWait > 0 {
+		s.stop = make(chan struct{})
+		s.stopped = make(chan struct{})
+		go s.flushEvery(batchWait)
+	}
+	return s, nil
+}
+
+// flushEvery 每隔 wait 写入一次缓冲中的记录，直到 Close
+func (s *redisStore) flushEvery(wait time.Duration) {
+	defer close(s.stopped)
+	ticker := time.NewTicker(wait)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+		}
+		s.mu.Lock()
+		broken := s.brokenErr != nil
+		s.mu.Unlock()
+		if broken {
+			continue
+		}
+		if err := s.writeBatch(s.flushCtx, s.takePending()); err != nil && err != errWriteBuffered {
+			s.mu.Lock()
+			if s.flushErr == nil {
+				s.flushErr = err
+			}
+			s.mu.Unlock()
+		}
+	}
+}
+
+// takePending 取出缓冲中的全部记录
+func (s *redisStore) takePending() []redisWrite {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	batch := s.pending
+	s.pending = nil
+	return batch
+}
+
+func (s *redisStore) entryKey(hashedKey string) string {
+	return s.prefix + "entry:" + hashedKey
+}
+
+// legacyInfoKey 和 legacyPathKey 是旧格式的两个 key
+func (s *redisStore) legacyInfoKey(hashedKey string) string {
+	return s.prefix + hashedKey
+}
+
+func (s *redisStore) legacyPathKey(hashedKey string) string {
+	return s.prefix + "path:" + hashedKey
+}
+
+const (
+	redisPingAttempts  = 5                      // 启动时连接 Redis 的尝试次数
+	redisWriteAttempts = 3                      // 写入和删除的尝试次数
+	redisRetryBase     = 100 * time.Millisecond // 第一次重试前的等待时间，之后每次翻倍
+	redisFailureLimit  = 5                      // 连续多少批写入失败后认为 Redis 不可用
+)
+
+// redisPendingLimit 是等待重写的缓冲中最多保留的记录数，Redis 长时间不可用时内存不会随扫描的文件数增长
+var redisPendingLimit = 100000
+
+// errWriteBuffered 表示这一批因为暂时性错误没有写入，已经放回缓冲等待重写；Put 不把它当作错误返回
+var errWriteBuffered = errors.New("write buffered for retry")
+
+// isRetriableRedisError 判断错误是否是暂时的：连接断开、网络错误和超时，
+// 以及 Redis 正在加载数据、主从切换等情况。命令本身的错误重试也不会成功
+func isRetriableRedisError(err error) bool {
+	if err == nil || err == redis.Nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	var redisErr redis.Error
+	if errors.As(err, &redisErr) {
+		for _, prefix := range []string{"LOADING ", "READONLY ", "TRYAGAIN ", "CLUSTERDOWN ", "MASTERDOWN "} {
+			if strings.HasPrefix(redisErr.Error(), prefix) {
+				return true
+			}
+		}
+		return false
+	}
+	// 其他错误（例如连接池已关闭）重试也不会成功
+	return false
+}
+
+// withRetry 执行 fn，遇到暂时性错误时按指数退避最多尝试 attempts 次；
+// 每次尝试都使用新的 -op-timeout 超时，ctx 结束后不再重试
+func withRetry(ctx context.Context, attempts int, op string, fn func(ctx context.Context) error) error {
+	delay := redisRetryBase
+	for attempt := 1; ; attempt++ {
+		opCtx, cancel := withOpTimeout(ctx)
+		err := fn(opCtx)
+		cancel()
+		if err == nil || attempt >= attempts || ctx.Err() != nil || !isRetriableRedisError(err) {
+			return err
+		}
+		verbosef("Redis %s failed (attempt %d of %d), retrying in %s: %s\n", op, attempt, attempts, delay, err)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return err
+		}
+		delay *= 2
+	}
+}
+
+// escapeGlob 转义 Redis glob 模式中的特殊字符
+func escapeGlob(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune(`*?[]\^`, r) {
+			b.WriteRune('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func (s *redisStore) Put(ctx context.Context, path string, fi FileInfo) error {
+	s.mu.Lock()
+	if err := s.brokenErr; err != nil {
+		s.requeueLocked([]redisWrite{{path, fi}})
+		s.mu.Unlock()
+		return err
+	}
+	if s.batchSize <= 1 {
+		s.mu.Unlock()
+		if err := s.writeBatch(ctx, []redisWrite{{path, fi}}); err != errWriteBuffered {
+			return err
+		}
+		return nil
+	}
+	s.pending = append(s.pending, redisWrite{path, fi})
+	var batch []redisWrite
+	if len(s.pending) >= s.batchSize {
+		batch = s.pending
+		s.pending = nil
+	}
+	err := s.flushErr
+	s.flushErr = nil
+	s.mu.Unlock()
+
+	if batchErr := s.writeBatch(ctx, batch); batchErr != nil && batchErr != errWriteBuffered {
+		err = batchErr
+	}
+	return err
+}
+
+// Flush 写入缓冲中的全部记录；仍有记录因为暂时性错误留在缓冲中，或者之前有记录因为缓冲已满被丢弃时返回错误
+func (s *redisStore) Flush(ctx context.Context) error {
+	err := s.writeBatch(ctx, s.takePending())
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err == errWriteBuffered {
+		err = fmt.Errorf("%d entries could not be written: %w", len(s.pending), s.lastErr)
+	}
+	if err == nil {
+		err = s.flushErr
+	}
+	s.flushErr = nil
+	if s.dropped > 0 {
+		if err == nil {
+			err = fmt.Errorf("%d entries were dropped while Redis was unavailable", s.dropped)
+		} else {
+			err = fmt.Errorf("%w; %d entries were dropped while Redis was unavailable", err, s.dropped)
+		}
+		s.dropped = 0
+	}
+	return err
+}
+
+// writeBatch 用一个管道写入 batch 中的所有记录，失败时整批重试；重试后仍因暂时性错误失败时
+// 这一批放回缓冲并返回 errWriteBuffered，Redis 不可用时返回包装了 errStoreUnavailable 的错误，
+// 其他错误表示这一批没有写入也不会再写
+func (s *redisStore) writeBatch(ctx context.Context, batch []redisWrite) error {
+	if len(batch) == 0 {
+		return nil
+	}
+	start := time.Now()
+	err := withRetry(ctx, redisWriteAttempts, "write", func(opCtx context.Context) error {
+		// 使用管道批量处理Redis命令
+		pipe := s.client.Pipeline()
+
+		// 这里我们添加命令到管道，但不立即检查错误
+		for _, w := range batch {
+			// Generate hash for the file path
+			hashedKey := generateHash(w.path)
+			pipe.HSet(opCtx, s.entryKey(hashedKey), "path", w.path, "size", w.info.Size, "mtime", w.info.ModTime.UnixNano(), "checksum", w.info.Checksum, "owner", formatOwner(w.info.Owner), "type", w.info.ContentType)
+			if s.ttl > 0 {
+				pipe.Expire(opCtx, s.entryKey(hashedKey), s.ttl)
+			} else {
+				pipe.Persist(opCtx, s.entryKey(hashedKey))
+			}
+			pipe.Del(opCtx, s.legacyInfoKey(hashedKey), s.legacyPathKey(hashedKey))
+		}
+
+		_, err := pipe.Exec(opCtx)
+		return err
+	})
+	observeRedisWrite(time.Since(start))
+	if err := s.noteResult(batch, err); err != nil {
+		return err
+	}
+	if err != nil && len(batch) > 1 {
+		return fmt.Errorf("executing pipeline for %d entries: %w", len(batch), err)
+	}
+	if err != nil {
+		return fmt.Errorf("executing pipeline: %w", err)
+	}
+	return nil
+}
+
+// noteResult 统计连续失败的批次：成功时清零并恢复 Put；因为网络错误、超时等暂时性错误（或者被取消）失败时
+// 把整批记录放回缓冲并返回 errWriteBuffered，连续失败达到 redisFailureLimit 时返回包装了 errStoreUnavailable 的错误。
+// WRONGTYPE 这类命令本身的错误再写一次也会失败，不放回缓冲，返回 nil，由 writeBatch 把错误返回给调用者报告
+func (s *redisStore) noteResult(batch []redisWrite, err error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err == nil {
+		s.failures = 0
+		s.brokenErr = nil
+		return nil
+	}
+	if !isRetriableRedisError(err) && !errors.Is(err, context.Canceled) {
+		return nil
+	}
+	s.requeueLocked(batch)
+	s.lastErr = err
+	s.failures++
+	if s.failures < redisFailureLimit {
+		return errWriteBuffered
+	}
+	s.brokenErr = fmt.Errorf("%w: %d writes in a row failed, last error: %v", errStoreUnavailable, s.failures, err)
+	return s.brokenErr
+}
+
+// requeueLocked 把记录放回缓冲，超过 redisPendingLimit 的部分丢弃并计数；调用者持有 s.mu
+func (s *redisStore) requeueLocked(batch []redisWrite) {
+	room := redisPendingLimit - len(s.pending)
+	if room < 0 {
+		room = 0
+	}
+	if len(batch) > room {
+		s.dropped += len(batch) - room
+		batch = batch[:room]
+	}
+	s.pending = append(s.pending, batch...)
+}
+
+// entryFields 是新格式 hash 中按顺序读取的字段，较早写入的记录可能没有 checksum、owner 和 type
+var entryFields = []string{"path", "size", "mtime", "checksum", "owner", "type"}
+
+// parseEntry 把 HMGET entryFields 的结果还原为路径和 FileInfo，记录不存在或不完整时 ok 为 false
+func parseEntry(values []interface{}) (path string, fi FileInfo, ok bool) {
+	if len(values) != len(entryFields) {
+		return "", FileInfo{}, false
+	}
+	path, ok1 := values[0].(string)
+	size, ok2 := values[1].(string)
+	mtime, ok3 := values[2].(string)
+	if !ok1 || !ok2 || !ok3 {
+		return "", FileInfo{}, false
+	}
+	sizeValue, err := strconv.ParseInt(size, 10, 64)
+	if err != nil {
+		return "", FileInfo{}, false
+	}
+	mtimeValue, err := strconv.ParseInt(mtime, 10, 64)
+	if err != nil {
+		return "", FileInfo{}, false
+	}
+	checksum, _ := values[3].(string)
+	owner, _ := values[4].(string)
+	contentType, _ := values[5].(string)
+	return path, FileInfo{Size: sizeValue, ModTime: time.Unix(0, mtimeValue), Checksum: checksum, Owner: parseOwner(owner), ContentType: contentType}, true
+}
+
+// decodeLegacyInfo 解码旧格式中 gob 编码的 FileInfo
+func decodeLegacyInfo(value []byte) (FileInfo, error) {
+	var fileInfo FileInfo
+	if err := gob.NewDecoder(bytes.NewReader(value)).Decode(&fileInfo); err != nil {
+		return FileInfo{}, fmt.Errorf("decoding: %w", err)
+	}
+	return fileInfo, nil
+}
+
+func (s *redisStore) Get(ctx context.Context, path string) (FileInfo, bool, error) {
+	hashedKey := generateHash(path)
+	opCtx, cancel := withOpTimeout(ctx)
+	defer cancel()
+	values, err := s.client.HMGet(opCtx, s.entryKey(hashedKey), entryFields...).Result()
+	if err != nil {
+		return FileInfo{}, false, err
+	}
+	if _, fileInfo, ok := parseEntry(values); ok {
+		return fileInfo, true, nil
+	}
+
+	value, err := s.client.Get(opCtx, s.legacyInfoKey(hashedKey)).Bytes()
+	if err == redis.Nil {
+		return FileInfo{}, false, nil
+	}
+	if err != nil {
+		return FileInfo{}, false, err
+	}
+	fileInfo, err := decodeLegacyInfo(value)
+	if err != nil {
+		return FileInfo{}, false, err
+	}
+	return fileInfo, true, nil
+}
+
+// iterateBatchSize 是 Iterate 每次批量读取的记录数
+const iterateBatchSize = 500
+
+// scanBatches 用 SCAN 找出 prefix 之后匹配 pattern 的 key，去掉 trim 前缀后每 iterateBatchSize 个调用一次 fn
+func (s *redisStore) scanBatches(ctx context.Context, pattern, trim string, fn func(hashedKeys []string) error) error {
+	opCtx, cancel := withOpTimeout(ctx)
+	iter := s.client.Scan(opCtx, 0, escapeGlob(s.prefix)+pattern, iterateBatchSize).Iterator()
+	cancel()
+
+	batch := make([]string, 0, iterateBatchSize)
+	for {
+		opCtx, cancel := withOpTimeout(ctx)
+		ok := iter.Next(opCtx)
+		cancel()
+		if ok {
+			batch = append(batch, strings.TrimPrefix(iter.Val(), s.prefix+trim))
+			if len(batch) < iterateBatchSize {
+				continue
+			}
+		}
+		if len(batch) > 0 {
+			if err := fn(batch); err != nil {
+				return err
+			}
+			batch = batch[:0]
+		}
+		if !ok {
+			break
+		}
+	}
+	return iter.Err()
+}
+
+// Iterate 先遍历新格式的记录，每批在一个管道中执行 HMGET；再遍历尚未迁移的旧格式记录，
+// 每批用两条 MGET 读取路径和 FileInfo
+func (s *redisStore) Iterate(ctx context.Context, fn func(path string, fi FileInfo) error) error {
+	err := s.scanBatches(ctx, "entry:*", "entry:", func(hashedKeys []string) error {
+		return s.iterateBatch(ctx, hashedKeys, fn)
+	})
+	if err != nil {
+		return err
+	}
+	return s.scanBatches(ctx, "path:*", "path:", func(hashedKeys []string) error {
+		return s.iterateLegacyBatch(ctx, hashedKeys, fn)
+	})
+}
+
+// iterateBatch 读取一批新格式的记录并依次调用 fn，已被删除或不完整的记录会被跳过
+func (s *redisStore) iterateBatch(ctx context.Context, hashedKeys []string, fn func(path string, fi FileInfo) error) error {
+	opCtx, cancel := withOpTimeout(ctx)
+	defer cancel()
+	pipe := s.client.Pipeline()
+	cmds := make([]*redis.SliceCmd, len(hashedKeys))
+	for i, h := range hashedKeys {
+		cmds[i] = pipe.HMGet(opCtx, s.entryKey(h), entryFields...)
+	}
+	if _, err := pipe.Exec(opCtx); err != nil {
+		return fmt.Errorf("reading entries: %w", err)
+	}
+
+	for _, cmd := range cmds {
+		originalPath, fileInfo, ok := parseEntry(cmd.Val())
+		if !ok {
+			continue
+		}
+		if err := fn(originalPath, fileInfo); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// iterateLegacyBatch 读取一批旧格式的记录并依次调用 fn，已被删除或无法解码的记录会被跳过
+func (s *redisStore) iterateLegacyBatch(ctx context.Context, hashedKeys []string, fn func(path string, fi FileInfo) error) error {
+	pathKeys := make([]string, len(hashedKeys))
+	infoKeys := make([]string, len(hashedKeys))
+	for i, h := range hashedKeys {
+		pathKeys[i] = s.legacyPathKey(h)
+		infoKeys[i] = s.legacyInfoKey(h)
+	}
+
+	opCtx, cancel := withOpTimeout(ctx)
+	defer cancel()
+	pipe := s.client.Pipeline()
+	pathsCmd := pipe.MGet(opCtx, pathKeys...)
+	infosCmd := pipe.MGet(opCtx, infoKeys...)
+	if _, err := pipe.Exec(opCtx); err != nil {
+		return fmt.Errorf("reading entries: %w", err)
+	}
+
+	infos := infosCmd.Val()
+	for i, p := range pathsCmd.Val() {
+		originalPath, ok := p.(string)
+		if !ok {
+			continue
+		}
+		value, ok := infos[i].(string)
+		if !ok {
+			continue
+		}
+		fileInfo, err := decodeLegacyInfo([]byte(value))
+		if err != nil {
+			continue
+		}
+		if err := fn(originalPath, fileInfo); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateLegacy 把旧格式的记录改写为新格式并删除旧 key，返回迁移的记录数
+func (s *redisStore) migrateLegacy(ctx context.Context) (int, error) {
+	type legacyEntry struct {
+		path string
+		info FileInfo
+	}
+	migrated := 0
+	err := s.scanBatches(ctx, "path:*", "path:", func(hashedKeys []string) error {
+		// 先读完整批再写入，写入会删除旧 key，不能和读取交错
+		var entries []legacyEntry
+		err := s.iterateLegacyBatch(ctx, hashedKeys, func(path string, fi FileInfo) error {
+			entries = append(entries, legacyEntry{path, fi})
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			if err := s.Put(ctx, e.path, e.info); err != nil {
+				return err
+			}
+			migrated++
+		}
+		// 旧 key 在写入新格式时才删除，下一批 SCAN 之前先写完这一批
+		return s.Flush(ctx)
+	})
+	return migrated, err
+}
+
+func (s *redisStore) Delete(ctx context.Context, path string) error {
+	hashedKey := generateHash(path)
+	return withRetry(ctx, redisWriteAttempts, "delete", func(opCtx context.Context) error {
+		return s.client.Del(opCtx, s.entryKey(hashedKey), s.legacyInfoKey(hashedKey), s.legacyPathKey(hashedKey)).Err()
+	})
+}
+
+// Close 停止后台定时写入，写入缓冲中剩下的记录后关闭连接；打开存储时的 ctx 已经取消时也会尝试写入
+func (s *redisStore) Close() error {
+	if s.stop != nil {
+		close(s.stop)
+		<-s.stopped
+		s.stop = nil
+	}
+	err := s.Flush(context.Background())
+	if closeErr := s.client.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/alicebob/miniredis/v2"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newTestRedisStore 启动一个进程内的 miniredis，返回连接到它的 redisStore，batchSize 为写入缓冲的条数
+func newTestRedisStore(tb testing.TB, batchSize int) (*redisStore, *miniredis.Miniredis) {
+	tb.Helper()
+	server, err := miniredis.Run()
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(server.Close)
+	s, err := newRedisStore(context.Background(), server.Addr(), "", 0, "test", 0, 10, batchSize, 0)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { s.Close() })
+	return s, server
+}
+
+// putEntries 写入 n 条记录，路径为 /scan/NNNNNN.bin
+func putEntries(tb testing.TB, s *redisStore, n int) {
+	tb.Helper()
+	ctx := context.Background()
+	mtime := time.Unix(1700000000, 0)
+	for i := 0; i < n; i++ {
+		if err := s.Put(ctx, fmt.Sprintf("/scan/%06d.bin", i), FileInfo{Size: int64(i), ModTime: mtime}); err != nil {
+			tb.Fatal(err)
+		}
+	}
+	if err := s.Flush(ctx); err != nil {
+		tb.Fatal(err)
+	}
+}
+
+func TestRedisIterate(t *testing.T) {
+	s, _ := newTestRedisStore(t, 100)
+	// 超过一批 SCAN 的数量，检查跨批次的记录都只返回一次
+	n := iterateBatchSize*2 + 17
+	putEntries(t, s, n)
+
+	seen := make(map[string]FileInfo)
+	err := s.Iterate(context.Background(), func(path string, fi FileInfo) error {
+		if _, dup := seen[path]; dup {
+			t.Errorf("%s returned twice", path)
+		}
+		seen[path] = fi
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(seen) != n {
+		t.Fatalf("got %d entries, want %d", len(seen), n)
+	}
+	for i := 0; i < n; i++ {
+		p := fmt.Sprintf("/scan/%06d.bin", i)
+		if fi, ok := seen[p]; !ok || fi.Size != int64(i) || fi.ModTime.Unix() != 1700000000 {
+			t.Errorf("%s: got %+v (present %v)", p, fi, ok)
+		}
+	}
+}
+
+// TestRedisWriteErrorNotRequeued 检查命令本身的错误（这里是 key 已经是另一种类型）直接返回给调用者，
+// 这一批不会放回缓冲反复重试，也不会让存储被当作不可用
+func TestRedisWriteErrorNotRequeued(t *testing.T) {
+	s, server := newTestRedisStore(t, 1)
+	ctx := context.Background()
+	server.Set(s.entryKey(generateHash("/scan/bad.bin")), "not a hash")
+
+	err := s.Put(ctx, "/scan/bad.bin", FileInfo{Size: 1})
+	if err == nil || !strings.Contains(err.Error(), "WRONGTYPE") {
+		t.Fatalf("Put error = %v, want the WRONGTYPE error", err)
+	}
+	if n := len(s.takePending()); n != 0 {
+		t.Errorf("%d writes requeued after a WRONGTYPE error, want 0", n)
+	}
+	if err := s.Put(ctx, "/scan/good.bin", FileInfo{Size: 2}); err != nil {
+		t.Fatalf("Put after a command error: %v", err)
+	}
+	if fi, ok, err := s.Get(ctx, "/scan/good.bin"); err != nil || !ok || fi.Size != 2 {
+		t.Errorf("Get = %+v, %v, %v, want the 2-byte entry", fi, ok, err)
+	}
+}
+
+// pendingCount 返回缓冲中等待写入的记录数
+func pendingCount(s *redisStore) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.pending)
+}
+
+// TestRedisWriteRequeuedOnNetworkError 检查 Redis 连不上时这一批放回缓冲、Put 不报错，
+// Redis 仍然连不上时 Flush 报告没写入的记录，恢复后 Flush 写入
+func TestRedisWriteRequeuedOnNetworkError(t *testing.T) {
+	s, server := newTestRedisStore(t, 1)
+	ctx := context.Background()
+	server.Close()
+	if err := s.Put(ctx, "/scan/a.bin", FileInfo{Size: 1}); err != nil {
+		t.Fatalf("Put with Redis down = %v, want nil with the write buffered", err)
+	}
+	if n := pendingCount(s); n != 1 {
+		t.Fatalf("%d writes requeued after a network error, want 1", n)
+	}
+	if err := s.Flush(ctx); err == nil || !strings.Contains(err.Error(), "1 entries could not be written") {
+		t.Errorf("Flush with Redis down = %v, want an error for the buffered entry", err)
+	}
+
+	if err := server.Restart(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if fi, ok, err := s.Get(ctx, "/scan/a.bin"); err != nil || !ok || fi.Size != 1 {
+		t.Errorf("Get = %+v, %v, %v, want the entry written by Flush", fi, ok, err)
+	}
+}
+
+// TestRedisBreakerOpen 检查连续失败后存储被当作不可用：之后的 Put 返回 errStoreUnavailable，
+// 缓冲不超过 redisPendingLimit，超出的记录只计数，由 Flush 报告一次
+func TestRedisBreakerOpen(t *testing.T) {
+	old := redisPendingLimit
+	redisPendingLimit = 8
+	t.Cleanup(func() { redisPendingLimit = old })
+
+	s, server := newTestRedisStore(t, 1)
+	ctx := context.Background()
+	server.Close()
+	for i := 0; i < redisFailureLimit; i++ {
+		err := s.Put(ctx, fmt.Sprintf("/scan/%d.bin", i), FileInfo{Size: 1})
+		if i < redisFailureLimit-1 && err != nil {
+			t.Fatalf("write %d: Put = %v, want nil while the breaker is closed", i, err)
+		}
+		if i == redisFailureLimit-1 && !errors.Is(err, errStoreUnavailable) {
+			t.Fatalf("write %d: Put = %v, want errStoreUnavailable", i, err)
+		}
+	}
+
+	// 断路器打开后 Put 不再访问 Redis，立即返回
+	start := time.Now()
+	for i := redisFailureLimit; i < 20; i++ {
+		if err := s.Put(ctx, fmt.Sprintf("/scan/%d.bin", i), FileInfo{Size: 1}); !errors.Is(err, errStoreUnavailable) {
+			t.Fatalf("write %d: Put = %v, want errStoreUnavailable", i, err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > redisRetryBase {
+		t.Errorf("Puts with the breaker open took %s, want them to skip Redis", elapsed)
+	}
+	if n := pendingCount(s); n != redisPendingLimit {
+		t.Errorf("%d writes buffered, want the limit %d", n, redisPendingLimit)
+	}
+
+	if err := server.Restart(); err != nil {
+		t.Fatal(err)
+	}
+	err := s.Flush(ctx)
+	if want := fmt.Sprintf("%d entries were dropped", 20-redisPendingLimit); err == nil || !strings.Contains(err.Error(), want) {
+		t.Errorf("Flush = %v, want it to report %q", err, want)
+	}
+	if err := s.Flush(ctx); err != nil {
+		t.Errorf("second Flush = %v, want the dropped entries reported only once", err)
+	}
+	if err := s.Put(ctx, "/scan/after.bin", FileInfo{Size: 1}); err != nil {
+		t.Errorf("Put after Redis came back = %v", err)
+	}
+	count := 0
+	if err := s.Iterate(ctx, func(string, FileInfo) error { count++; return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if count != redisPendingLimit+1 {
+		t.Errorf("%d entries stored, want the %d buffered ones and the new one", count, redisPendingLimit+1)
+	}
+}
+
+// benchEntries 是基准测试中缓存的记录数
+const benchEntries = 100000
+
+var (
+	benchStoreOnce sync.Once
+	benchStore     *redisStore
+	benchStoreErr  error
+)
+
+// sharedBenchStore 返回写好 benchEntries 条记录的 redisStore，所有基准测试共用，避免每次重新写入
+func sharedBenchStore(b *testing.B) *redisStore {
+	b.Helper()
+	benchStoreOnce.Do(func() {
+		server, err := miniredis.Run()
+		if err != nil {
+			benchStoreErr = err
+			return
+		}
+		benchStore, benchStoreErr = newRedisStore(context.Background(), server.Addr(), "", 0, "bench", 0, 10, 1000, 0)
+		if benchStoreErr != nil {
+			return
+		}
+		putEntries(b, benchStore, benchEntries)
+	})
+	if benchStoreErr != nil {
+		b.Fatal(benchStoreErr)
+	}
+	return benchStore
+}
+
+// BenchmarkIterate 遍历 10 万条记录：每批 SCAN 得到的 key 在一个管道中执行 HMGET
+func BenchmarkIterate(b *testing.B) {
+	s := sharedBenchStore(b)
+	ctx := context.Background()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		count := 0
+		err := s.Iterate(ctx, func(path string, fi FileInfo) error {
+			count++
+			return nil
+		})
+		if err != nil {
+			b.Fatal(err)
+		}
+		if count != benchEntries {
+			b.Fatalf("got %d entries, want %d", count, benchEntries)
+		}
+	}
+}
+
+// BenchmarkIterateSerial 是对照：同样的 SCAN，但每个 key 单独请求一次，与改为管道之前的读取方式相同
+func BenchmarkIterateSerial(b *testing.B) {
+	s := sharedBenchStore(b)
+	ctx := context.Background()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		count := 0
+		err := s.scanBatches(ctx, "entry:*", "entry:", func(hashedKeys []string) error {
+			for _, h := range hashedKeys {
+				values, err := s.client.HMGet(ctx, s.entryKey(h), entryFields...).Result()
+				if err != nil {
+					return err
+				}
+				if _, _, ok := parseEntry(values); ok {
+					count++
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			b.Fatal(err)
+		}
+		if count != benchEntries {
+			b.Fatalf("got %d entries, want %d", count, benchEntries)
+		}
+	}
+}
+
+// BenchmarkPut 检查每次 Put 的分配量是固定的：写入记录时不再有 gob 编码，分配只来自管道中的命令，
+// batch 模式下按批次摊薄；等待写入的记录少于 batchSize 条，内存与扫描的文件数无关。
+// miniredis 运行在同一个进程中，B/op 和 allocs/op 也包括服务端的分配
+func BenchmarkPut(b *testing.B) {
+	for _, batchSize := range []int{1, 100, 1000} {
+		b.Run(fmt.Sprintf("batch=%d", batchSize), func(b *testing.B) {
+			s, _ := newTestRedisStore(b, batchSize)
+			ctx := context.Background()
+			mtime := time.Unix(1700000000, 0)
+			paths := make([]string, 10000)
+			for i := range paths {
+				paths[i] = fmt.Sprintf("/scan/dir%03d/file%06d.bin", i%100, i)
+			}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := s.Put(ctx, paths[i%len(paths)], FileInfo{Size: int64(i), ModTime: mtime}); err != nil {
+					b.Fatal(err)
+				}
+				if i%batchSize == 0 {
+					if n := pendingCount(s); n >= batchSize && batchSize > 1 {
+						b.Fatalf("%d writes buffered, want fewer than the batch size %d", n, batchSize)
+					}
+				}
+			}
+			if err := s.Flush(ctx); err != nil {
+				b.Fatal(err)
+			}
+			b.StopTimer()
+			if n := pendingCount(s); n != 0 {
+				b.Fatalf("%d writes left in the buffer", n)
+			}
+		})
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	_ "github.com/mattn/go-sqlite3"
+	"time"
+)
+
+// sqliteStore 把扫描结果保存在本地 SQLite 文件中，不需要额外的服务
+type sqliteStore struct {
+	db        *sql.DB
+	namespace string
+}
+
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS files (
+	namespace TEXT NOT NULL,
+	path      TEXT NOT NULL,
+	size      INTEGER NOT NULL,
+	mod_time  INTEGER NOT NULL,
+	checksum  TEXT NOT NULL DEFAULT '',
+	owner     TEXT NOT NULL DEFAULT '',
+	content_type TEXT NOT NULL DEFAULT '',
+	PRIMARY KEY (namespace, path)
+)`
+
+// addMissingColumns 给较早版本创建的 files 表补上 checksum、owner 和 content_type 列
+func addMissingColumns(ctx context.Context, db *sql.DB) error {
+	rows, err := db.QueryContext(ctx, `SELECT name FROM pragma_table_info('files')`)
+	if err != nil {
+		return err
+	}
+	found := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return err
+		}
+		found[name] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, column := range []string{"checksum", "owner", "content_type"} {
+		if found[column] {
+			continue
+		}
+		if _, err := db.ExecContext(ctx, `ALTER TABLE files ADD COLUMN `+column+` TEXT NOT NULL DEFAULT ''`); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newSQLiteStore 打开（必要时创建）SQLite 数据库
+func newSQLiteStore(ctx context.Context, path, namespace string) (*sqliteStore, error) {
+	db, err := sql.Open("sqlite3", "file:"+path+"?_journal_mode=WAL&_synchronous=NORMAL&_busy_timeout=5000")
+	if err != nil {
+		return nil, err
+	}
+	// SQLite 同一时间只允许一个写入者，多个 worker 共用一个连接即可
+	db.SetMaxOpenConns(1)
+
+	opCtx, cancel := withOpTimeout(ctx)
+	defer cancel()
+	if _, err := db.ExecContext(opCtx, sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("opening SQLite database %s: %w", path, err)
+	}
+	if err := addMissingColumns(opCtx, db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("upgrading SQLite database %s: %w", path, err)
+	}
+	return &sqliteStore{db: db, namespace: namespace}, nil
+}
+
+func (s *sqliteStore) Put(ctx context.Context, path string, fi FileInfo) error {
+	opCtx, cancel := withOpTimeout(ctx)
+	defer cancel()
+	_, err := s.db.ExecContext(opCtx,
+		`INSERT INTO files (namespace, path, size, mod_time, checksum, owner, content_type) VALUES (?, ?, ?, ?, ?, ?, ?)
+		 ON CONFLICT (namespace, path) DO UPDATE SET size = excluded.size, mod_time = excluded.mod_time, checksum = excluded.checksum,
+		 owner = excluded.owner, content_type = excluded.content_type`,
+		s.namespace, path, fi.Size, fi.ModTime.UnixNano(), fi.Checksum, formatOwner(fi.Owner), fi.ContentType)
+	return err
+}
+
+func (s *sqliteStore) Get(ctx context.Context, path string) (FileInfo, bool, error) {
+	opCtx, cancel := withOpTimeout(ctx)
+	defer cancel()
+	var size, modTime int64
+	var checksum, owner, contentType string
+	err := s.db.QueryRowContext(opCtx, `SELECT size, mod_time, checksum, owner, content_type FROM files WHERE namespace = ? AND path = ?`,
+		s.namespace, path).Scan(&size, &modTime, &checksum, &owner, &contentType)
+	if err == sql.ErrNoRows {
+		return FileInfo{}, false, nil
+	}
+	if err != nil {
+		return FileInfo{}, false, err
+	}
+	return FileInfo{Size: size, ModTime: time.Unix(0, modTime), Checksum: checksum, Owner: parseOwner(owner), ContentType: contentType}, true, nil
+}
+
+// Iterate 在遍历期间占用唯一的连接，fn 中不能再访问同一个 store
+func (s *sqliteStore) Iterate(ctx context.Context, fn func(path string, fi FileInfo) error) error {
+	rows, err := s.db.QueryContext(ctx, `SELECT path, size, mod_time, checksum, owner, content_type FROM files WHERE namespace = ?`, s.namespace)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var path, checksum, owner, contentType string
+		var size, modTime int64
+		if err := rows.Scan(&path, &size, &modTime, &checksum, &owner, &contentType); err != nil {
+			return err
+		}
+		fi := FileInfo{Size: size, ModTime: time.Unix(0, modTime), Checksum: checksum, Owner: parseOwner(owner), ContentType: contentType}
+		if err := fn(path, fi); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func (s *sqliteStore) Delete(ctx context.Context, path string) error {
+	opCtx, cancel := withOpTimeout(ctx)
+	defer cancel()
+	_, err := s.db.ExecContext(opCtx, `DELETE FROM files WHERE namespace = ? AND path = ?`, s.namespace, path)
+	return err
+}
+
+func (s *sqliteStore) Flush(ctx context.Context) error {
+	return nil
+}
+
+func (s *sqliteStore) Close() error {
+	return s.db.Close()
+}
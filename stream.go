@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+// resultStreamSize 是结果 channel 的缓冲大小，消费者偶尔变慢时 worker 不必立刻等待
+const resultStreamSize = 1024
+
+// resultStream 不为 nil 时，processFile 把每个处理完的文件（包括未变化、未重新写入的文件）发送到这里，
+// 消费者可以在遍历结束之前就开始处理结果
+var resultStream chan fileEntry
+
+// startResultStream 创建 resultStream，并启动把每个结果写成一行 "大小,路径" 到 w 的消费者。
+// 返回的函数在所有 worker 都结束后调用：关闭 channel，等消费者写完剩下的结果。
+// 扫描被取消时已经投递的文件仍会被处理和发送，消费者一直读到 channel 关闭，worker 不会阻塞
+func startResultStream(w io.Writer, dir string, absPaths bool) (stop func()) {
+	results := make(chan fileEntry, resultStreamSize)
+	resultStream = results
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for e := range results {
+			fmt.Fprintf(w, "%d,%s\n", e.Info.Size, csvQuote(displayPath(dir, e.Path, absPaths)))
+		}
+	}()
+	return func() {
+		resultStream = nil
+		close(results)
+		wg.Wait()
+	}
+}
+
+// countFile 把一个处理完的文件计入进度，有 resultStream 时同时发送给消费者，有 pathList 时写入路径；
+// 计数达到 -limit 时停止遍历
+func countFile(path string, info FileInfo) {
+	if resultStream != nil {
+		resultStream <- fileEntry{Path: path, Info: info}
+	}
+	if pathList != nil {
+		pathList.add(path)
+	}
+	n := atomic.AddInt32(&progressCounter, 1)
+	atomic.AddInt64(&bytesCounter, info.Size)
+	if fileLimit > 0 && n == fileLimit {
+		atomic.StoreInt32(&limitReached, 1)
+		stopScan()
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// humanMode 是 -human 的取值：auto 只在输出到终端时打印易读的汇总，always 总是打印，never 不打印
+var humanMode = "auto"
+
+// summaryTop 是易读汇总中列出的最大文件和重复文件组的数量
+const summaryTop = 10
+
+const (
+	ansiBold   = "\x1b[1m"
+	ansiRed    = "\x1b[31m"
+	ansiYellow = "\x1b[33m"
+	ansiReset  = "\x1b[0m"
+)
+
+// isTerminal 判断 w 是否是终端，没有依赖 isatty，字符设备即视为终端
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// humanOutput 根据 -human 判断是否打印易读的汇总，以及是否使用颜色；
+// 只有输出到终端且没有设置 NO_COLOR 时才使用颜色，-human always 而输出重定向到文件时是纯文本
+func humanOutput(w io.Writer) (human, color bool) {
+	tty := isTerminal(w)
+	switch humanMode {
+	case "always":
+		human = true
+	case "auto":
+		human = tty
+	}
+	_, noColor := os.LookupEnv("NO_COLOR")
+	return human, human && tty && !noColor
+}
+
+// scanSummary 是易读汇总中展示的内容，同样的数字在 Final 行和各个日志中也有
+type scanSummary struct {
+	Files     int64
+	Bytes     int64
+	Unchanged int64
+	Errors    int
+	Elapsed   time.Duration
+	Largest   []fileEntry // 按大小从大到小
+	Dupes     []dupeGroup // 按浪费的空间从大到小
+}
+
+// summaryWriter 输出对齐的汇总，color 为 true 时给标题和较大的数值加上 ANSI 颜色
+type summaryWriter struct {
+	w     io.Writer
+	color bool
+}
+
+func (s summaryWriter) heading(title string) {
+	if s.color {
+		title = ansiBold + title + ansiReset
+	}
+	fmt.Fprintln(s.w, title)
+}
+
+// size 把 formatBytes 的结果右对齐到 width 列，1 GiB 以上标红，100 MiB 以上标黄
+func (s summaryWriter) size(n int64, width int) string {
+	text := fmt.Sprintf("%*s", width, formatBytes(n))
+	if !s.color {
+		return text
+	}
+	switch {
+	case n >= 1<<30:
+		return ansiRed + text + ansiReset
+	case n >= 100<<20:
+		return ansiYellow + text + ansiReset
+	}
+	return text
+}
+
+// printSummary 输出扫描结束后的易读汇总：总计、最大的几个文件以及浪费空间最多的重复文件组
+func printSummary(w io.Writer, color bool, sum scanSummary, dir string, absPaths bool) {
+	s := summaryWriter{w: w, color: color}
+	rows := [][2]string{
+		{"Files", formatCount(sum.Files)},
+		{"Total size", formatBytes(sum.Bytes)},
+		{"Unchanged", formatCount(sum.Unchanged)},
+		{"Errors", formatCount(int64(sum.Errors))},
+		{"Elapsed", sum.Elapsed.Round(100 * time.Millisecond).String()},
+	}
+	width := 0
+	for _, r := range rows {
+		if len(r[1]) > width {
+			width = len(r[1])
+		}
+	}
+	fmt.Fprintln(w)
+	s.heading("Scan summary")
+	for _, r := range rows {
+		fmt.Fprintf(w, "  %-12s%*s\n", r[0], width, r[1])
+	}
+
+	if len(sum.Largest) > 0 {
+		width = 0
+		for _, e := range sum.Largest {
+			if n := len(formatBytes(e.Info.Size)); n > width {
+				width = n
+			}
+		}
+		fmt.Fprintln(w)
+		s.heading("Largest files")
+		for _, e := range sum.Largest {
+			fmt.Fprintf(w, "  %s  %s\n", s.size(e.Info.Size, width), displayPath(dir, e.Path, absPaths))
+		}
+	}
+
+	if len(sum.Dupes) > 0 {
+		width = 0
+		for _, g := range sum.Dupes {
+			if n := len(formatBytes(g.waste())); n > width {
+				width = n
+			}
+		}
+		fmt.Fprintln(w)
+		s.heading("Most wasted space in duplicates")
+		for _, g := range sum.Dupes {
+			paths := make([]string, len(g.Paths))
+			for i, p := range g.Paths {
+				paths[i] = displayPath(dir, p, absPaths)
+			}
+			fmt.Fprintf(w, "  %s  %d copies of %s: %s\n", s.size(g.waste(), width), len(g.Paths), formatBytes(g.Size), strings.Join(paths, ", "))
+		}
+	}
+}
+
+// largestFiles 从存储中找出最大的 n 个文件，按大小从大到小排序；与日志一样跳过 opts 的大小范围之外的记录
+func largestFiles(ctx context.Context, store Store, n int, opts saveOptions) ([]fileEntry, error) {
+	largest := newTopHeap(n, sortSize, false)
+	err := store.Iterate(ctx, func(path string, fi FileInfo) error {
+		if opts.inSizeRange(fi.Size) {
+			largest.offer(fileEntry{Path: path, Info: fi})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return largestEntries(largest.entries, n), nil
+}
+
+// largestEntries 返回 entries 中最大的 n 个，按大小从大到小排序
+func largestEntries(entries []fileEntry, n int) []fileEntry {
+	sort.Slice(entries, func(i, j int) bool {
+		return entryLess(entries[i], entries[j], sortSize, false)
+	})
+	if len(entries) > n {
+		entries = entries[:n]
+	}
+	return entries
+}
+
+// mostWasted 返回浪费空间最多的 n 组重复文件，不修改 groups 的顺序
+func mostWasted(groups []dupeGroup, n int) []dupeGroup {
+	sorted := append([]dupeGroup(nil), groups...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].waste() > sorted[j].waste()
+	})
+	if len(sorted) > n {
+		sorted = sorted[:n]
+	}
+	return sorted
+}
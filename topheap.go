@@ -0,0 +1,55 @@
+package main
+
+import "container/heap"
+
+// fileEntry 把路径和对应的 FileInfo 放在一起
+type fileEntry struct {
+	Path string
+	Info FileInfo
+}
+
+// topHeap 是一个容量受限的最小堆，堆顶是当前保留的记录中排序最靠后的一条，
+// 这样遍历缓存时内存只与保留的条数 N 有关
+type topHeap struct {
+	entries []fileEntry
+	present map[string]bool
+	limit   int
+	key     sortKey
+	reverse bool
+}
+
+func newTopHeap(limit int, key sortKey, reverse bool) *topHeap {
+	return &topHeap{present: make(map[string]bool), limit: limit, key: key, reverse: reverse}
+}
+
+func (h *topHeap) Len() int { return len(h.entries) }
+func (h *topHeap) Less(i, j int) bool {
+	return entryLess(h.entries[j], h.entries[i], h.key, h.reverse)
+}
+func (h *topHeap) Swap(i, j int)      { h.entries[i], h.entries[j] = h.entries[j], h.entries[i] }
+func (h *topHeap) Push(x interface{}) { h.entries = append(h.entries, x.(fileEntry)) }
+func (h *topHeap) Pop() interface{} {
+	last := h.entries[len(h.entries)-1]
+	h.entries = h.entries[:len(h.entries)-1]
+	return last
+}
+
+// offer 尝试加入一条记录，超出容量时淘汰排序最靠后的记录
+func (h *topHeap) offer(e fileEntry) {
+	// Redis SCAN 可能重复返回同一个 key
+	if h.present[e.Path] {
+		return
+	}
+	if len(h.entries) < h.limit {
+		heap.Push(h, e)
+		h.present[e.Path] = true
+		return
+	}
+	if !entryLess(e, h.entries[0], h.key, h.reverse) {
+		return
+	}
+	delete(h.present, h.entries[0].Path)
+	h.entries[0] = e
+	h.present[e.Path] = true
+	heap.Fix(h, 0)
+}
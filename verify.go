@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// checksumMismatch 是一个大小和修改时间都没变、但内容校验和与缓存不一致的文件，可能是位衰减
+type checksumMismatch struct {
+	Path    string
+	Stored  string
+	Current string
+}
+
+// checksumVerifier 在 -verify 模式下计算文件内容的校验和，并收集与缓存不一致的文件
+type checksumVerifier struct {
+	checked    int64 // Files whose content was hashed, updated atomically
+	hasher     *hashPipeline
+	mu         sync.Mutex
+	mismatches []checksumMismatch
+}
+
+func newChecksumVerifier(hasher *hashPipeline) *checksumVerifier {
+	return &checksumVerifier{hasher: hasher}
+}
+
+// check 计算文件当前的校验和。unchanged 表示大小和修改时间与缓存一致，
+// 这时如果缓存中已有不同的校验和就记录一次不一致并返回 ok == false；
+// 缓存中的校验和由另一种 -hash-algo 算法计算时无法比较，直接换成当前的校验和；计算失败时返回 stored，让缓存中原有的校验和保持不变
+func (v *checksumVerifier) check(path, stored string, unchanged bool) (checksum string, ok bool) {
+	current, err := v.hasher.hash(path)
+	if err != nil {
+		scanErrors.add("hash", path, err)
+		return stored, true
+	}
+	atomic.AddInt64(&v.checked, 1)
+	if unchanged && stored != "" && checksumAlgo(stored) == hashAlgo && stored != current {
+		verbosef("Checksum mismatch: %s\n", path)
+		v.mu.Lock()
+		v.mismatches = append(v.mismatches, checksumMismatch{Path: path, Stored: stored, Current: current})
+		v.mu.Unlock()
+		return stored, false
+	}
+	return current, true
+}
+
+// sorted 返回按路径排序的不一致列表
+func (v *checksumVerifier) sorted() []checksumMismatch {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	list := append([]checksumMismatch(nil), v.mismatches...)
+	sort.Slice(list, func(i, j int) bool { return list[i].Path < list[j].Path })
+	return list
+}
+
+// saveMismatchesToFile 每行写出一个不一致的文件："缓存中的校验和,当前校验和,路径"
+func saveMismatchesToFile(dir, filename string, mismatches []checksumMismatch, absPaths bool) error {
+	file, err := createOutputFile(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	for _, m := range mismatches {
+		fmt.Fprintf(file, "%s,%s,%s\n", m.Stored, m.Current, csvQuote(displayPath(dir, m.Path, absPaths)))
+	}
+	return file.commit()
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// watchInterval 是 -watch 指定的两轮扫描之间的间隔，0 表示只扫描一次
+var watchInterval time.Duration
+
+// watchStopped 在扫描过程中收到 SIGINT/SIGTERM 时置为 1，-watch 不再开始下一轮
+var watchStopped int32
+
+// runWatch 执行一次扫描；指定了 -watch 时每隔 watchInterval 重新扫描，直到收到信号。
+// 每一轮都调用一次 runScan，重新解析参数、打开存储，未变化的文件照常跳过，所以之后的每一轮都很快。
+// 返回最后一轮的退出码
+func runWatch() int {
+	defer stopMetrics()
+	for pass := 1; ; pass++ {
+		code := runScan()
+		if watchInterval <= 0 || code == 2 || atomic.LoadInt32(&watchStopped) != 0 {
+			return code
+		}
+
+		infof("Pass %d finished, next scan in %s\n", pass, watchInterval)
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		timer := time.NewTimer(watchInterval)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			stop()
+			infof("Stopping watch\n")
+			return code
+		}
+		stop()
+		resetScanState()
+	}
+}
+
+// resetScanState 清空上一轮扫描留下的计数器、错误和参数，让 runScan 可以再执行一次
+func resetScanState() {
+	flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	atomic.StoreInt32(&progressCounter, 0)
+	atomic.StoreInt64(&bytesCounter, 0)
+	atomic.StoreInt64(&unchangedCounter, 0)
+	atomic.StoreInt64(&scannedCounter, 0)
+	atomic.StoreInt32(&storeFailed, 0)
+	atomic.StoreInt64(&storeUnavailableCounter, 0)
+	atomic.StoreInt32(&limitReached, 0)
+	scanErrors.reset()
+	dupes = nil
+	verifier = nil
+	typeDetector = nil
+}